@@ -0,0 +1,204 @@
+package main
+
+// discover.go: runtime block-device discovery (chunk4-4), replacing the
+// hardcoded `devices` list. Walks /sys/block, optionally filtered by
+// -devices (explicit list, which bypasses discovery), -transport
+// (usb,nvme,virtio,scsi,...), and -exclude (glob patterns on device name).
+// deviceSet re-runs discovery periodically (see main's rediscover ticker)
+// so hot-plugged/removed devices show up without a restart, and tracks
+// each device's consecutive getInflight failures so a device that's gone
+// bad gets dropped instead of showing zeros forever.
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// defaultExcludePatterns skips synthetic block devices that are never
+// interesting to this tool unless explicitly asked for via -devices.
+var defaultExcludePatterns = []string{"loop*", "ram*", "zram*", "dm-*", "md*"}
+
+// discoverDevices lists current /sys/block entries. If explicit is
+// non-empty it is returned as-is (the user knows what they want);
+// otherwise every /sys/block entry not matching an exclude pattern, and (if
+// transports is non-empty) whose resolved transport is in transports, is
+// returned, sorted for a stable display order.
+func discoverDevices(explicit, transports, exclude []string) ([]string, error) {
+	if len(explicit) > 0 {
+		return explicit, nil
+	}
+	if len(exclude) == 0 {
+		exclude = defaultExcludePatterns
+	}
+
+	entries, err := os.ReadDir("/sys/block")
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if matchesAny(exclude, name) {
+			continue
+		}
+		if len(transports) > 0 && !matchesAny(transports, deviceTransport(name)) {
+			continue
+		}
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// deviceTransport resolves a block device's bus type (usb, nvme, virtio,
+// scsi, ...) by following /sys/block/<dev>/device's symlink chain upward and
+// checking each ancestor's "subsystem" link - the same approach tools like
+// udevadm use internally. A scsi ancestor does not end the walk, since USB
+// mass storage sits on a SCSI device below its USB interface: the result is
+// "usb" if a USB ancestor is found above it, otherwise "scsi". Returns "" if
+// it can't be determined (e.g. virtual devices with no backing "device" link).
+func deviceTransport(dev string) string {
+	devicePath, err := filepath.EvalSymlinks(filepath.Join("/sys/block", dev, "device"))
+	if err != nil {
+		return ""
+	}
+	dir := devicePath
+	sawSCSI := false
+	for i := 0; i < 10 && dir != "/" && dir != "."; i++ {
+		if subsystem, err := filepath.EvalSymlinks(filepath.Join(dir, "subsystem")); err == nil {
+			switch base := filepath.Base(subsystem); base {
+			case "usb", "nvme", "virtio":
+				return base
+			case "scsi":
+				sawSCSI = true
+			}
+		}
+		dir = filepath.Dir(dir)
+	}
+	if sawSCSI {
+		return "scsi"
+	}
+	return ""
+}
+
+// parseCommaList splits a comma-separated flag value, dropping empty
+// entries; returns nil for an empty input.
+func parseCommaList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// maxConsecutiveFailures is how many consecutive getInflight failures a
+// device tolerates before deviceSet drops it.
+const maxConsecutiveFailures = 5
+
+// deviceSet is the live, periodically-refreshed list of devices this
+// monitor tracks, along with each device's consecutive getInflight failure
+// count.
+type deviceSet struct {
+	mu       sync.Mutex
+	list     []string
+	failures map[string]int
+}
+
+func newDeviceSet(initial []string) *deviceSet {
+	return &deviceSet{list: initial, failures: make(map[string]int)}
+}
+
+// devices returns a snapshot of the current device list.
+func (d *deviceSet) devices() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]string, len(d.list))
+	copy(out, d.list)
+	return out
+}
+
+// refresh re-runs discovery and replaces the tracked list, logging any
+// additions/removals and calling onAdd/onRemove so the caller can
+// create/drop per-device sampler state accordingly.
+func (d *deviceSet) refresh(explicit, transports, exclude []string, onAdd, onRemove func(dev string)) {
+	discovered, err := discoverDevices(explicit, transports, exclude)
+	if err != nil {
+		log.Printf("device discovery failed: %v", err)
+		return
+	}
+
+	d.mu.Lock()
+	old := make(map[string]bool, len(d.list))
+	for _, dev := range d.list {
+		old[dev] = true
+	}
+	newSet := make(map[string]bool, len(discovered))
+	for _, dev := range discovered {
+		newSet[dev] = true
+	}
+	d.list = discovered
+	d.mu.Unlock()
+
+	for dev := range newSet {
+		if !old[dev] {
+			log.Printf("device %s appeared", dev)
+			if onAdd != nil {
+				onAdd(dev)
+			}
+		}
+	}
+	for dev := range old {
+		if !newSet[dev] {
+			log.Printf("device %s disappeared", dev)
+			if onRemove != nil {
+				onRemove(dev)
+			}
+		}
+	}
+}
+
+// recordResult tracks getInflight's consecutive failures for dev, dropping
+// it from the tracked list (with a warning) once maxConsecutiveFailures is
+// reached. Returns whether dev was just dropped, so the caller can also
+// clean up its sampler state.
+func (d *deviceSet) recordResult(dev string, err error) (dropped bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err == nil {
+		delete(d.failures, dev)
+		return false
+	}
+	d.failures[dev]++
+	if d.failures[dev] < maxConsecutiveFailures {
+		return false
+	}
+	log.Printf("dropping %s after %d consecutive getInflight failures: %v", dev, d.failures[dev], err)
+	delete(d.failures, dev)
+	for i, existing := range d.list {
+		if existing == dev {
+			d.list = append(d.list[:i], d.list[i+1:]...)
+			break
+		}
+	}
+	return true
+}
@@ -0,0 +1,174 @@
+package main
+
+// iostat.go: per-tick IOPS/throughput/service-time/%util derived from
+// /sys/block/<dev>/stat (chunk4-5), turning this from an inflight-only
+// monitor into something closer to iostat. Each tick's raw counters are
+// diffed against the previous tick's counters for that device to get an
+// interval rate; see deriveIOMetrics. Which derived columns render() shows
+// is controlled by -columns.
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sectorBytes is the fixed 512-byte unit /sys/block stat sector counts use,
+// regardless of the device's actual logical block size.
+const sectorBytes = 512
+
+// blockStat is the subset of /sys/block/<dev>/stat this tool cares about,
+// in the kernel's documented field order (Documentation/ABI/testing/sysfs-block).
+type blockStat struct {
+	ReadsCompleted  uint64
+	ReadSectors     uint64
+	ReadTicks       uint64 // milliseconds
+	WritesCompleted uint64
+	WriteSectors    uint64
+	WriteTicks      uint64 // milliseconds
+	IOInProgress    uint64
+	IOTicks         uint64 // milliseconds the device had at least one IO in progress
+	TimeInQueue     uint64
+}
+
+// readBlockStat parses /sys/block/<dev>/stat, the same source `iostat`
+// itself reads. Only the first 9 of its (at least 11) whitespace-separated
+// fields are used; those 9 have been present since 2.6.
+func readBlockStat(dev string) (blockStat, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/sys/block/%s/stat", dev))
+	if err != nil {
+		return blockStat{}, err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < 9 {
+		return blockStat{}, fmt.Errorf("invalid stat format for %s", dev)
+	}
+
+	var vals [9]uint64
+	for i := 0; i < 9; i++ {
+		v, err := strconv.ParseUint(fields[i], 10, 64)
+		if err != nil {
+			return blockStat{}, fmt.Errorf("parsing stat field %d for %s: %w", i, dev, err)
+		}
+		vals[i] = v
+	}
+
+	return blockStat{
+		ReadsCompleted:  vals[0],
+		ReadSectors:     vals[1],
+		ReadTicks:       vals[2],
+		WritesCompleted: vals[3],
+		WriteSectors:    vals[4],
+		WriteTicks:      vals[5],
+		IOInProgress:    vals[6],
+		IOTicks:         vals[7],
+		TimeInQueue:     vals[8],
+	}, nil
+}
+
+// ioMetrics is one interval's derived rates, computed by diffing two
+// blockStat samples taken interval apart.
+type ioMetrics struct {
+	ReadIOPS     float64
+	WriteIOPS    float64
+	MBps         float64
+	AvgServiceMs float64 // (read+write ticks) delta / (read+write ops) delta
+	UtilPct      float64 // io_ticks delta / interval, clamped to 100
+}
+
+// deriveIOMetrics computes interval rates from two consecutive blockStat
+// samples of the same device. Counters are monotonically increasing for the
+// life of the device, so a wrapped or reset counter (e.g. after a
+// hot-unplug/replug) would show as a negative delta; deriveIOMetrics treats
+// that as "no data this interval" rather than report nonsense.
+func deriveIOMetrics(prev, cur blockStat, interval time.Duration) ioMetrics {
+	secs := interval.Seconds()
+	ms := float64(interval.Milliseconds())
+	if secs <= 0 || ms <= 0 {
+		return ioMetrics{}
+	}
+
+	readOps, ok1 := subUint64(cur.ReadsCompleted, prev.ReadsCompleted)
+	writeOps, ok2 := subUint64(cur.WritesCompleted, prev.WritesCompleted)
+	readSectors, ok3 := subUint64(cur.ReadSectors, prev.ReadSectors)
+	writeSectors, ok4 := subUint64(cur.WriteSectors, prev.WriteSectors)
+	readTicks, ok5 := subUint64(cur.ReadTicks, prev.ReadTicks)
+	writeTicks, ok6 := subUint64(cur.WriteTicks, prev.WriteTicks)
+	ioTicks, ok7 := subUint64(cur.IOTicks, prev.IOTicks)
+	if !ok1 || !ok2 || !ok3 || !ok4 || !ok5 || !ok6 || !ok7 {
+		return ioMetrics{}
+	}
+
+	m := ioMetrics{
+		ReadIOPS:  float64(readOps) / secs,
+		WriteIOPS: float64(writeOps) / secs,
+		MBps:      float64((readSectors+writeSectors)*sectorBytes) / (1 << 20) / secs,
+		UtilPct:   float64(ioTicks) / ms * 100,
+	}
+	if m.UtilPct > 100 {
+		m.UtilPct = 100
+	}
+	if totalOps := readOps + writeOps; totalOps > 0 {
+		m.AvgServiceMs = float64(readTicks+writeTicks) / float64(totalOps)
+	}
+	return m
+}
+
+// subUint64 returns cur-prev and true, or (0, false) if cur < prev (a
+// counter reset, e.g. from a hot-unplug/replug).
+func subUint64(cur, prev uint64) (uint64, bool) {
+	if cur < prev {
+		return 0, false
+	}
+	return cur - prev, true
+}
+
+// defaultColumns is shown when -columns is unset.
+var defaultColumns = []string{"inflight", "iops", "mbps", "util", "await", "m1", "m5", "m15"}
+
+var validColumns = map[string]bool{
+	"inflight": true,
+	"iops":     true,
+	"mbps":     true,
+	"util":     true,
+	"await":    true,
+	"m1":       true,
+	"m5":       true,
+	"m15":      true,
+}
+
+// parseColumns parses -columns, ignoring (and logging a warning about) any
+// unrecognized entries. An empty or all-invalid value falls back to
+// defaultColumns.
+func parseColumns(s string) []string {
+	if s == "" {
+		return defaultColumns
+	}
+
+	var out []string
+	for _, c := range parseCommaList(s) {
+		if validColumns[c] {
+			out = append(out, c)
+		} else {
+			log.Printf("ignoring unknown -columns entry %q", c)
+		}
+	}
+	if len(out) == 0 {
+		return defaultColumns
+	}
+	return out
+}
+
+// columnSelected reports whether name is among columns.
+func columnSelected(columns []string, name string) bool {
+	for _, c := range columns {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package main
+
+// meter.go: Meter-style exponentially-weighted moving averages (chunk4-6),
+// as in go-metrics' EWMA/Meter. Each device gets three rates (1m/5m/15m),
+// ticked independently of the 100ms sampling loop on their own
+// meterTickInterval cadence so the smoothing period is decoupled from
+// -decay-alpha and the inflight sample interval. Each tick folds in the
+// average combined read+write IOPS (see iostat.go) observed since the last
+// tick, giving a Unix-load-average-like view of queue activity that's far
+// steadier than any single sample.
+
+import (
+	"math"
+	"time"
+)
+
+// meterTickInterval is how often EWMA.update is called; it, not the
+// underlying sample rate, is what period is relative to in the alpha
+// formula below.
+const meterTickInterval = 5 * time.Second
+
+// EWMA is a single exponentially-weighted moving average, as in go-metrics:
+// alpha = 1-exp(-tickInterval/period) so that, ticked every tickInterval, it
+// converges with the given time constant. The first update seeds the rate
+// directly rather than decaying up from zero, so early samples aren't
+// artificially suppressed.
+type EWMA struct {
+	alpha  float64
+	rate   float64
+	seeded bool
+}
+
+// newEWMA builds an EWMA with the given averaging period, ticked every
+// tickInterval.
+func newEWMA(period, tickInterval time.Duration) *EWMA {
+	return &EWMA{alpha: 1 - math.Exp(-tickInterval.Seconds()/period.Seconds())}
+}
+
+// update folds in the latest instantaneous value.
+func (e *EWMA) update(instant float64) {
+	if !e.seeded {
+		e.rate = instant
+		e.seeded = true
+		return
+	}
+	e.rate += e.alpha * (instant - e.rate)
+}
+
+// Rate returns the current smoothed rate.
+func (e *EWMA) Rate() float64 { return e.rate }
+
+// meterSet holds one device's 1m/5m/15m EWMAs, plus the accumulator used to
+// average samples between ticks.
+type meterSet struct {
+	m1, m5, m15 *EWMA
+	accumSum    float64
+	accumCount  int
+}
+
+func newMeterSet() *meterSet {
+	return &meterSet{
+		m1:  newEWMA(time.Minute, meterTickInterval),
+		m5:  newEWMA(5*time.Minute, meterTickInterval),
+		m15: newEWMA(15*time.Minute, meterTickInterval),
+	}
+}
+
+// accumulate folds one sample into the set's between-tick accumulator.
+func (s *meterSet) accumulate(value float64) {
+	s.accumSum += value
+	s.accumCount++
+}
+
+// tick averages the accumulated samples since the last tick (0 if none were
+// seen) into all three EWMAs, then resets the accumulator.
+func (s *meterSet) tick() {
+	instant := 0.0
+	if s.accumCount > 0 {
+		instant = s.accumSum / float64(s.accumCount)
+	}
+	s.m1.update(instant)
+	s.m5.update(instant)
+	s.m15.update(instant)
+	s.accumSum = 0
+	s.accumCount = 0
+}
@@ -0,0 +1,205 @@
+package main
+
+// reporter.go: a pluggable Reporter interface (chunk4-3), modeled on
+// go-metrics' InfluxDB/Graphite reporters. A dedicated goroutine on its own
+// ticker (see runReporters) snapshots each device's decaying sampler,
+// computes the configured percentiles plus mean and max, and hands the
+// batch to every configured Reporter - currently InfluxDB line protocol and
+// Graphite plaintext.
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// reportPercentiles are the percentiles each Reporter includes in a flush,
+// independent of the terminal display's longer percentiles list.
+var reportPercentiles = []float64{50, 90, 99}
+
+// deviceReport is one device's computed stats for a single flush.
+type deviceReport struct {
+	device  string
+	current float64
+	mean    float64
+	max     float64
+	pcts    map[float64]float64 // keyed by entries of reportPercentiles
+}
+
+// Reporter periodically flushes a batch of deviceReports somewhere.
+type Reporter interface {
+	Report(reports []deviceReport)
+}
+
+// currentsStore holds the latest per-device inflight snapshot behind a
+// mutex, so runReporters (ticking on its own interval) can read a
+// consistent snapshot without coupling to the main sampling loop.
+type currentsStore struct {
+	mu     sync.Mutex
+	values map[string]int
+}
+
+func (c *currentsStore) set(values map[string]int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values = values
+}
+
+func (c *currentsStore) snapshot() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]int, len(c.values))
+	for k, v := range c.values {
+		out[k] = v
+	}
+	return out
+}
+
+// buildReports snapshots each device's decaying sampler into a deviceReport.
+// Callers from a goroutine other than main's sampling loop must hold
+// deviceMapsMu while calling this, since decaying's keys can otherwise be
+// mutated concurrently by device discovery (see deviceSet in discover.go).
+func buildReports(devs []string, decaying map[string]*DecayingSampler, currents map[string]int) []deviceReport {
+	reports := make([]deviceReport, 0, len(devs))
+	for _, dev := range devs {
+		samples := decaying[dev].GetSamples()
+		sorted := make([]int, len(samples))
+		copy(sorted, samples)
+		sort.Ints(sorted)
+
+		rep := deviceReport{
+			device:  dev,
+			current: float64(currents[dev]),
+			mean:    calcAverage(samples),
+			pcts:    make(map[float64]float64, len(reportPercentiles)),
+		}
+		if len(sorted) > 0 {
+			rep.max = float64(sorted[len(sorted)-1])
+		}
+		for _, pct := range reportPercentiles {
+			rep.pcts[pct] = calcPercentileFloat(sorted, pct)
+		}
+		reports = append(reports, rep)
+	}
+	return reports
+}
+
+// reportWithRetry runs send, retrying a few times with simple backoff on
+// failure. All failures are logged, never fatal - a reporting destination
+// being down shouldn't stop the monitor.
+func reportWithRetry(name string, send func() error) {
+	backoff := 500 * time.Millisecond
+	for attempt := 1; attempt <= 3; attempt++ {
+		if err := send(); err != nil {
+			log.Printf("report(%s): attempt %d failed: %v", name, attempt, err)
+			time.Sleep(backoff)
+			backoff *= 2
+			continue
+		}
+		return
+	}
+	log.Printf("report(%s): giving up after 3 attempts", name)
+}
+
+// InfluxReporter flushes each deviceReport as one InfluxDB line-protocol
+// point per device, POSTed to url as a single-write batch.
+type InfluxReporter struct {
+	url         string
+	measurement string
+	tags        string // pre-formatted "key=value,key2=value2", or ""
+	client      *http.Client
+}
+
+func NewInfluxReporter(url, measurement, tags string) *InfluxReporter {
+	return &InfluxReporter{url: url, measurement: measurement, tags: tags, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (r *InfluxReporter) Report(reports []deviceReport) {
+	var buf bytes.Buffer
+	now := time.Now().UnixNano()
+	for _, rep := range reports {
+		tags := fmt.Sprintf("device=%s", rep.device)
+		if r.tags != "" {
+			tags += "," + r.tags
+		}
+		fmt.Fprintf(&buf, "%s,%s current=%g,mean=%g,max=%g", r.measurement, tags, rep.current, rep.mean, rep.max)
+		for _, pct := range reportPercentiles {
+			fmt.Fprintf(&buf, ",p%g=%g", pct, rep.pcts[pct])
+		}
+		fmt.Fprintf(&buf, " %d\n", now)
+	}
+	reportWithRetry("influx", func() error {
+		resp, err := r.client.Post(r.url, "text/plain; charset=utf-8", bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("influx write returned %s", resp.Status)
+		}
+		return nil
+	})
+}
+
+// GraphiteReporter flushes each deviceReport as Graphite plaintext lines,
+// written over a single TCP connection per flush.
+type GraphiteReporter struct {
+	addr   string
+	prefix string
+}
+
+func NewGraphiteReporter(addr, prefix string) *GraphiteReporter {
+	return &GraphiteReporter{addr: addr, prefix: prefix}
+}
+
+func (r *GraphiteReporter) Report(reports []deviceReport) {
+	var buf bytes.Buffer
+	now := time.Now().Unix()
+	for _, rep := range reports {
+		base := fmt.Sprintf("%s.%s", r.prefix, rep.device)
+		fmt.Fprintf(&buf, "%s.current %g %d\n", base, rep.current, now)
+		fmt.Fprintf(&buf, "%s.mean %g %d\n", base, rep.mean, now)
+		fmt.Fprintf(&buf, "%s.max %g %d\n", base, rep.max, now)
+		for _, pct := range reportPercentiles {
+			fmt.Fprintf(&buf, "%s.p%g %g %d\n", base, pct, rep.pcts[pct], now)
+		}
+	}
+	reportWithRetry("graphite", func() error {
+		conn, err := net.DialTimeout("tcp", r.addr, 5*time.Second)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		_, err = conn.Write(buf.Bytes())
+		return err
+	})
+}
+
+// runReporters is the dedicated goroutine that snapshots each device's
+// decaying sampler every reportInterval and hands the batch to every
+// configured Reporter. A no-op if reporters is empty.
+func runReporters(reporters []Reporter, devSet *deviceSet, decaying map[string]*DecayingSampler, latest *currentsStore, reportInterval time.Duration, done <-chan struct{}) {
+	if len(reporters) == 0 {
+		return
+	}
+	ticker := time.NewTicker(reportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			deviceMapsMu.Lock()
+			reports := buildReports(devSet.devices(), decaying, latest.snapshot())
+			deviceMapsMu.Unlock()
+			for _, r := range reporters {
+				r.Report(reports)
+			}
+		}
+	}
+}
@@ -1,31 +1,80 @@
 package main
 
+// NOTE(chunk4-1..chunk4-6): this backups/ copy and the root usb-queue-monitor-v2.go
+// have each grown their own forward-decaying reservoir, Prometheus endpoint,
+// InfluxDB/Graphite reporters, /sys/block auto-discovery, and EWMA rates in
+// parallel (see chunk4-1..chunk4-6 and chunk2-1..chunk2-6 respectively), with
+// no shared code and two independently hand-rolled reservoir/EWMA
+// implementations as a result. That divergence predates this file's own
+// edits; flagging it here rather than merging unilaterally, since whether
+// backups/ is still meant to receive new-feature work (vs. only bugfixes,
+// or being retired in favor of v2) is a call for whoever owns this package's
+// roadmap, not something to decide mid-review.
+
 import (
+	"container/heap"
 	"flag"
 	"fmt"
 	"log"
+	"math"
 	"math/rand"
+	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const (
 	sampleInterval = 100 * time.Millisecond
 	reservoirSize  = 10000
 	maxQueue       = 30
+
+	// defaultDecayAlpha matches go-metrics' ExpDecaySample default: a
+	// sample's weight relative to a newer one falls by a factor of e for
+	// every 1/alpha (~67) seconds between them.
+	defaultDecayAlpha   = 0.015
+	defaultDecayRescale = time.Hour
 )
 
-var devices = []string{"sdc", "sdd", "sde", "sdf", "sdg", "sdh", "sdb", "sdi"}
+// deviceMapsMu guards the decaying/lifetime sampler maps against the one
+// cross-goroutine access to them: runReporters' buildReports, which reads
+// the maps from its own ticker goroutine while main's select loop may be
+// adding/removing devices (see deviceSet in discover.go). main's own reads
+// and writes need no lock, since they all happen on that one goroutine.
+var deviceMapsMu sync.Mutex
 
 // Configurable percentiles to display
 var percentiles = []float64{0, 10, 20, 30, 40, 50, 60, 70, 80, 90, 95, 99, 99.5, 99.9, 99.99, 100}
 
+// Prometheus metrics, registered and served under -listen. All three are
+// updated from the same goroutine that samples devices (see main), so no
+// extra locking is needed on the write side; promhttp's scrape handler is
+// safe to call concurrently with those updates.
+var (
+	inflightGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "usb_queue_inflight",
+		Help: "Current in-flight IO count per device.",
+	}, []string{"device"})
+	sampleCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "usb_queue_samples_total",
+		Help: "Total inflight samples collected per device.",
+	}, []string{"device"})
+	inflightHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "usb_queue_inflight_observed",
+		Help:    "Distribution of observed in-flight IO counts per device.",
+		Buckets: []float64{0, 1, 2, 3, 4, 5, 7, 10, 15, 20, 30, 50},
+	}, []string{"device"})
+)
+
 // ReservoirSampler maintains a fixed-size representative sample using reservoir sampling
 type ReservoirSampler struct {
 	reservoir []int
@@ -70,6 +119,123 @@ func (rs *ReservoirSampler) GetCount() uint64 {
 	return rs.count
 }
 
+// decaySample is one (priority, value) pair kept in a DecayingSampler's
+// min-heap, ordered by priority so the stalest sample (the minimum) is
+// always at the root and can be evicted in O(log n).
+type decaySample struct {
+	priority float64
+	value    int
+}
+
+// decayHeap is a container/heap.Interface min-heap of decaySamples.
+type decayHeap []decaySample
+
+func (h decayHeap) Len() int           { return len(h) }
+func (h decayHeap) Less(i, j int) bool { return h[i].priority < h[j].priority }
+func (h decayHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *decayHeap) Push(x interface{}) {
+	*h = append(*h, x.(decaySample))
+}
+
+func (h *decayHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// DecayingSampler is a forward-decaying priority reservoir, as used by
+// go-metrics' ExpDecaySample (itself based on Cormode/Shkapenyuk/
+// Muthukrishnan's forward-decay biased sampling): each Add(v) at time t is
+// assigned priority exp(alpha*(t-t0).Seconds())/rand.Float64(), so recent
+// samples are far more likely to survive eviction than old ones, giving
+// percentiles that track roughly the last 1/alpha seconds instead of the
+// uniform reservoir's whole lifetime. t0 and every stored priority are
+// periodically rescaled down so the priorities stay numerically bounded
+// over a long-running process.
+type DecayingSampler struct {
+	mu           sync.Mutex
+	alpha        float64
+	size         int
+	rescaleEvery time.Duration
+	heap         decayHeap
+	t0           time.Time
+	nextRescale  time.Time
+	count        uint64
+	rng          *rand.Rand
+}
+
+// NewDecayingSampler creates a forward-decaying sampler retaining at most
+// size samples, with the given decay rate and rescale period.
+func NewDecayingSampler(size int, alpha float64, rescaleEvery time.Duration) *DecayingSampler {
+	now := time.Now()
+	return &DecayingSampler{
+		alpha:        alpha,
+		size:         size,
+		rescaleEvery: rescaleEvery,
+		t0:           now,
+		nextRescale:  now.Add(rescaleEvery),
+		rng:          rand.New(rand.NewSource(now.UnixNano())),
+	}
+}
+
+// Add inserts value, replacing the reservoir's minimum-priority entry if
+// the reservoir is already full and the new sample outranks it.
+func (s *DecayingSampler) Add(value int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.After(s.nextRescale) {
+		s.rescale(now)
+	}
+
+	priority := math.Exp(s.alpha*now.Sub(s.t0).Seconds()) / s.rng.Float64()
+	s.count++
+	sample := decaySample{priority: priority, value: value}
+
+	if s.heap.Len() < s.size {
+		heap.Push(&s.heap, sample)
+		return
+	}
+	if s.heap.Len() > 0 && priority > s.heap[0].priority {
+		s.heap[0] = sample
+		heap.Fix(&s.heap, 0)
+	}
+}
+
+// rescale re-landmarks the sampler at t0'=now, multiplying every stored
+// priority by exp(-alpha*(t0'-t0)) to keep them numerically bounded.
+func (s *DecayingSampler) rescale(now time.Time) {
+	factor := math.Exp(-s.alpha * now.Sub(s.t0).Seconds())
+	for i := range s.heap {
+		s.heap[i].priority *= factor
+	}
+	heap.Init(&s.heap)
+	s.t0 = now
+	s.nextRescale = now.Add(s.rescaleEvery)
+}
+
+// GetSamples returns a copy of the reservoir's values, unordered.
+func (s *DecayingSampler) GetSamples() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	samples := make([]int, len(s.heap))
+	for i, sample := range s.heap {
+		samples[i] = sample.value
+	}
+	return samples
+}
+
+// GetCount returns the total number of samples seen (not just those retained).
+func (s *DecayingSampler) GetCount() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
 // getInflight reads the current in-flight IO count for a device
 func getInflight(device string) (int, error) {
 	data, err := os.ReadFile(fmt.Sprintf("/sys/block/%s/inflight", device))
@@ -205,7 +371,13 @@ func formatPercentileHeader(pct float64) string {
 	return fmt.Sprintf("P%.1f", pct)
 }
 
-func (d *Display) render(samplers map[string]*ReservoirSampler, currents map[string]int) {
+// render prints one frame. The inflight percentile table comes from each
+// device's decaying reservoir (so P90 et al. track the last ~1/alpha
+// seconds of behavior), with the uniform lifetime reservoir's P90 shown in
+// its own column for comparison against the whole run. Which of that table
+// and the /sys/block/<dev>/stat-derived iostat columns are shown is
+// controlled by columns (see -columns / parseColumns).
+func (d *Display) render(devs []string, decaying map[string]*DecayingSampler, lifetime map[string]*ReservoirSampler, currents map[string]int, columns []string, ioCurrent map[string]ioMetrics, meters map[string]*meterSet) {
 	d.clear()
 
 	timestamp := time.Now().Format("Mon Jan 02 15:04:05 2006")
@@ -216,46 +388,117 @@ func (d *Display) render(samplers map[string]*ReservoirSampler, currents map[str
 		fmt.Printf("USB Queue Monitor - %s\n", timestamp)
 	}
 
-	// Build dynamic header
-	lineWidth := 8 + 9 + len(percentiles)*9 + 2 + maxQueue + 2
-	fmt.Println(strings.Repeat("=", lineWidth))
-	fmt.Printf("%-8s %8s", "Device", "Current")
-	for _, pct := range percentiles {
-		fmt.Printf(" %8s", formatPercentileHeader(pct))
-	}
-	fmt.Printf("  Utilization\n")
-	fmt.Println(strings.Repeat("-", lineWidth))
-
-	for _, dev := range devices {
-		current := currents[dev]
-		pcts := calcPercentiles(samplers[dev].GetSamples())
-		// Find P90 for bar display (index 3 if using default percentiles)
-		p90Int := 0
-		for i, pct := range percentiles {
-			if pct == 90 {
-				p90Int = int(pcts[i] + 0.5)
-				break
+	showInflight := columnSelected(columns, "inflight")
+
+	if showInflight {
+		// Build dynamic header
+		lineWidth := 8 + 9 + len(percentiles)*9 + 9 + 2 + maxQueue + 2
+		fmt.Println(strings.Repeat("=", lineWidth))
+		fmt.Printf("%-8s %8s", "Device", "Current")
+		for _, pct := range percentiles {
+			fmt.Printf(" %8s", formatPercentileHeader(pct))
+		}
+		fmt.Printf(" %8s", "LifeP90")
+		fmt.Printf("  Utilization\n")
+		fmt.Println(strings.Repeat("-", lineWidth))
+
+		for _, dev := range devs {
+			current := currents[dev]
+			pcts := calcPercentiles(decaying[dev].GetSamples())
+			// Find P90 for bar display (index 9 if using default percentiles)
+			p90Int := 0
+			for i, pct := range percentiles {
+				if pct == 90 {
+					p90Int = int(pcts[i] + 0.5)
+					break
+				}
 			}
+			bar := makeBar(current, p90Int, maxQueue)
+			fmt.Printf("%-8s %4d/%-3d", dev, current, maxQueue)
+			for _, val := range pcts {
+				fmt.Printf(" %8.2f", val)
+			}
+			lifetimeP90 := calcPercentile(lifetime[dev].GetSamples(), 90)
+			fmt.Printf(" %8d", lifetimeP90)
+			fmt.Printf("  [%s]\n", bar)
+		}
+		fmt.Println()
+	}
+
+	showIOStat := columnSelected(columns, "iops") || columnSelected(columns, "mbps") || columnSelected(columns, "util") || columnSelected(columns, "await")
+	showMeters := columnSelected(columns, "m1") || columnSelected(columns, "m5") || columnSelected(columns, "m15")
+
+	if showIOStat || showMeters {
+		fmt.Printf("%-8s", "Device")
+		if columnSelected(columns, "iops") {
+			fmt.Printf(" %9s %9s", "ReadIOPS", "WriteIOPS")
+		}
+		if columnSelected(columns, "mbps") {
+			fmt.Printf(" %8s", "MB/s")
+		}
+		if columnSelected(columns, "await") {
+			fmt.Printf(" %9s", "Await(ms)")
+		}
+		if columnSelected(columns, "util") {
+			fmt.Printf(" %7s", "%Util")
+		}
+		if columnSelected(columns, "m1") {
+			fmt.Printf(" %7s", "1m")
+		}
+		if columnSelected(columns, "m5") {
+			fmt.Printf(" %7s", "5m")
 		}
-		bar := makeBar(current, p90Int, maxQueue)
-		fmt.Printf("%-8s %4d/%-3d", dev, current, maxQueue)
-		for _, val := range pcts {
-			fmt.Printf(" %8.2f", val)
+		if columnSelected(columns, "m15") {
+			fmt.Printf(" %7s", "15m")
+		}
+		fmt.Println()
+
+		for _, dev := range devs {
+			m := ioCurrent[dev]
+			fmt.Printf("%-8s", dev)
+			if columnSelected(columns, "iops") {
+				fmt.Printf(" %9.1f %9.1f", m.ReadIOPS, m.WriteIOPS)
+			}
+			if columnSelected(columns, "mbps") {
+				fmt.Printf(" %8.2f", m.MBps)
+			}
+			if columnSelected(columns, "await") {
+				fmt.Printf(" %9.2f", m.AvgServiceMs)
+			}
+			if columnSelected(columns, "util") {
+				fmt.Printf(" %6.1f%%", m.UtilPct)
+			}
+			if ms, ok := meters[dev]; ok {
+				if columnSelected(columns, "m1") {
+					fmt.Printf(" %7.1f", ms.m1.Rate())
+				}
+				if columnSelected(columns, "m5") {
+					fmt.Printf(" %7.1f", ms.m5.Rate())
+				}
+				if columnSelected(columns, "m15") {
+					fmt.Printf(" %7.1f", ms.m15.Rate())
+				}
+			}
+			fmt.Println()
 		}
-		fmt.Printf("  [%s]\n", bar)
+		fmt.Println()
 	}
 
-	fmt.Println()
 	if d.batchMode {
-		fmt.Println("Legend: █ = current  ░ = p90 (long-term)  - = unused")
+		fmt.Println("Legend: █ = current  ░ = p90 (decaying, ~recent)  - = unused")
 	} else {
-		fmt.Printf("Legend: █= current  ░= p90 (long-term)  -= unused\n")
+		fmt.Printf("Legend: █= current  ░= p90 (decaying, ~recent)  -= unused\n")
 	}
 
-	// Use the first device's sampler for total count (they're all the same)
-	sampleCount := samplers[devices[0]].GetCount()
-	reservoirCount := len(samplers[devices[0]].GetSamples())
-	fmt.Printf("Samples: %s total (%d in reservoir)\n", formatCount(sampleCount), reservoirCount)
+	// Use the first device's samplers for total counts (devices present since
+	// startup all share them; one added later by rediscovery has fewer).
+	if len(devs) > 0 {
+		sampleCount := lifetime[devs[0]].GetCount()
+		lifetimeReservoirCount := len(lifetime[devs[0]].GetSamples())
+		decayReservoirCount := len(decaying[devs[0]].GetSamples())
+		fmt.Printf("Samples: %s total (%d in lifetime reservoir, %d in decaying reservoir)\n",
+			formatCount(sampleCount), lifetimeReservoirCount, decayReservoirCount)
+	}
 
 	if d.batchMode {
 		fmt.Println()
@@ -264,22 +507,79 @@ func (d *Display) render(samplers map[string]*ReservoirSampler, currents map[str
 
 func main() {
 	batchMode := flag.Bool("batch", false, "Enable batch mode (no screen clearing, suitable for nohup)")
+	decayAlpha := flag.Float64("decay-alpha", defaultDecayAlpha, "forward-decay reservoir alpha (higher = more weight on very recent samples)")
+	decayRescale := flag.Duration("decay-rescale", defaultDecayRescale, "how often the forward-decay reservoir rescales its priorities")
+	listenAddr := flag.String("listen", "", "address to serve Prometheus /metrics on (e.g. :9110); empty disables it")
+	influxURL := flag.String("influx-url", "", "InfluxDB write URL to report percentiles to (e.g. http://localhost:8086/write?db=usbqueue); empty disables it")
+	graphiteAddr := flag.String("graphite-addr", "", "Graphite plaintext carbon address to report percentiles to (e.g. localhost:2003); empty disables it")
+	reportInterval := flag.Duration("report-interval", 10*time.Second, "flush interval for -influx-url/-graphite-addr reporters")
+	devicesFlag := flag.String("devices", "", "explicit comma-separated device list (e.g. sdc,sdd); overrides auto-discovery")
+	transportFlag := flag.String("transport", "", "comma-separated transport filter for auto-discovery (e.g. usb,nvme)")
+	excludeFlag := flag.String("exclude", "", "comma-separated glob patterns to exclude from auto-discovery (default: loop*,ram*,zram*,dm-*,md*)")
+	columnsFlag := flag.String("columns", "", "comma-separated display columns: inflight,iops,mbps,util,await,m1,m5,m15 (default: all)")
 	flag.Parse()
 
+	columns := parseColumns(*columnsFlag)
+
 	// Setup logging
 	if *batchMode {
 		log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds)
 		log.Println("USB Queue Monitor starting in batch mode")
 	}
 
-	// Initialize samplers for each device
-	samplers := make(map[string]*ReservoirSampler)
-	for _, dev := range devices {
-		samplers[dev] = NewReservoirSampler(reservoirSize)
+	explicitDevices := parseCommaList(*devicesFlag)
+	transports := parseCommaList(*transportFlag)
+	exclude := parseCommaList(*excludeFlag)
+
+	initial, err := discoverDevices(explicitDevices, transports, exclude)
+	if err != nil {
+		log.Fatalf("device discovery failed: %v", err)
+	}
+	if len(initial) == 0 {
+		log.Fatal("no block devices found (check -devices/-transport/-exclude)")
+	}
+	devSet := newDeviceSet(initial)
+
+	// Initialize samplers for each device: a forward-decaying reservoir for
+	// the recent-behavior percentile columns, and a uniform reservoir kept
+	// for the whole run for the LifeP90 column.
+	decaying := make(map[string]*DecayingSampler)
+	lifetime := make(map[string]*ReservoirSampler)
+	// meters holds each device's 1m/5m/15m EWMA of combined IOPS (see
+	// meter.go); only main's own goroutine ever touches it, so it needs no
+	// locking the way decaying/lifetime do.
+	meters := make(map[string]*meterSet)
+	for _, dev := range initial {
+		decaying[dev] = NewDecayingSampler(reservoirSize, *decayAlpha, *decayRescale)
+		lifetime[dev] = NewReservoirSampler(reservoirSize)
+		meters[dev] = newMeterSet()
 	}
 
 	display := &Display{batchMode: *batchMode}
 
+	if *listenAddr != "" {
+		prometheus.MustRegister(inflightGauge, sampleCounter, inflightHistogram)
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		go func() {
+			log.Printf("Serving Prometheus /metrics on %s", *listenAddr)
+			if err := http.ListenAndServe(*listenAddr, mux); err != nil {
+				log.Printf("HTTP server stopped: %v", err)
+			}
+		}()
+	}
+
+	var reporters []Reporter
+	if *influxURL != "" {
+		reporters = append(reporters, NewInfluxReporter(*influxURL, "usb_queue", ""))
+	}
+	if *graphiteAddr != "" {
+		reporters = append(reporters, NewGraphiteReporter(*graphiteAddr, "usb_queue"))
+	}
+	latestCurrents := &currentsStore{}
+	done := make(chan struct{})
+	go runReporters(reporters, devSet, decaying, latestCurrents, *reportInterval, done)
+
 	// Setup signal handling for clean shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
@@ -296,9 +596,43 @@ func main() {
 	ticker := time.NewTicker(sampleInterval)
 	defer ticker.Stop()
 
+	rediscoverTicker := time.NewTicker(30 * time.Second)
+	defer rediscoverTicker.Stop()
+
+	meterTicker := time.NewTicker(meterTickInterval)
+	defer meterTicker.Stop()
+
+	// prevStat/prevStatTime hold each device's last /sys/block/<dev>/stat
+	// sample so deriveIOMetrics can diff it against the next one; ioCurrent
+	// holds the latest derived metrics for render. All three are only ever
+	// touched from this goroutine, so (unlike decaying/lifetime) they need
+	// no locking.
+	prevStat := make(map[string]blockStat)
+	prevStatTime := make(map[string]time.Time)
+	ioCurrent := make(map[string]ioMetrics)
+
+	addDevice := func(dev string) {
+		deviceMapsMu.Lock()
+		decaying[dev] = NewDecayingSampler(reservoirSize, *decayAlpha, *decayRescale)
+		lifetime[dev] = NewReservoirSampler(reservoirSize)
+		deviceMapsMu.Unlock()
+		meters[dev] = newMeterSet()
+	}
+	removeDevice := func(dev string) {
+		deviceMapsMu.Lock()
+		delete(decaying, dev)
+		delete(lifetime, dev)
+		deviceMapsMu.Unlock()
+		delete(prevStat, dev)
+		delete(prevStatTime, dev)
+		delete(ioCurrent, dev)
+		delete(meters, dev)
+	}
+
 	for {
 		select {
 		case <-sigChan:
+			close(done)
 			if *batchMode {
 				log.Println("Received interrupt signal, shutting down...")
 			} else {
@@ -306,12 +640,25 @@ func main() {
 			}
 			return
 
+		case <-rediscoverTicker.C:
+			devSet.refresh(explicitDevices, transports, exclude, addDevice, removeDevice)
+
+		case <-meterTicker.C:
+			for _, ms := range meters {
+				ms.tick()
+			}
+
 		case <-ticker.C:
+			devs := devSet.devices()
 			currents := make(map[string]int)
 
 			// Collect samples
-			for _, dev := range devices {
+			for _, dev := range devs {
 				current, err := getInflight(dev)
+				if devSet.recordResult(dev, err) {
+					removeDevice(dev)
+					continue
+				}
 				if err != nil {
 					if *batchMode {
 						log.Printf("ERROR: Failed to read inflight for %s: %v", dev, err)
@@ -319,11 +666,35 @@ func main() {
 					current = 0
 				}
 				currents[dev] = current
-				samplers[dev].Add(current)
+				decaying[dev].Add(current)
+				lifetime[dev].Add(current)
+
+				if *listenAddr != "" {
+					inflightGauge.WithLabelValues(dev).Set(float64(current))
+					sampleCounter.WithLabelValues(dev).Inc()
+					inflightHistogram.WithLabelValues(dev).Observe(float64(current))
+				}
+
+				if stat, err := readBlockStat(dev); err == nil {
+					now := time.Now()
+					if prev, ok := prevStat[dev]; ok {
+						m := deriveIOMetrics(prev, stat, now.Sub(prevStatTime[dev]))
+						ioCurrent[dev] = m
+						if ms, ok := meters[dev]; ok {
+							ms.accumulate(m.ReadIOPS + m.WriteIOPS)
+						}
+					}
+					prevStat[dev] = stat
+					prevStatTime[dev] = now
+				} else if *batchMode {
+					log.Printf("ERROR: Failed to read stat for %s: %v", dev, err)
+				}
 			}
 
+			latestCurrents.set(currents)
+
 			// Display current state
-			display.render(samplers, currents)
+			display.render(devSet.devices(), decaying, lifetime, currents, columns, ioCurrent, meters)
 		}
 	}
 }
@@ -0,0 +1,129 @@
+package main
+
+// correlate.go: the `blk-latency correlate` subcommand - runs the same eBPF
+// tracer as `live` in the background and periodically joins its per-device
+// view against `zpool iostat -wv`, so queue amplification introduced by the
+// ZFS stack (vdev mirroring/checksumming/etc above the raw device) shows up
+// directly as a side-by-side comparison instead of requiring two tools.
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runCorrelate is the `blk-latency correlate` subcommand.
+func runCorrelate(args []string) {
+	fs := flag.NewFlagSet("correlate", flag.ExitOnError)
+	correlateInterval := fs.Duration("i", 10*time.Second, "correlation refresh interval")
+	fs.Parse(args)
+
+	t, err := startTracer(nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer t.Close()
+
+	done := make(chan struct{})
+	go t.consume(done, nil)
+
+	log.Printf("Correlating eBPF latency with zpool iostat (interval=%v)...", *correlateInterval)
+	ticker := time.NewTicker(*correlateInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		renderCorrelated(t.state)
+	}
+}
+
+// renderCorrelated prints one side-by-side table: for each zpool summary
+// column with samples, its eBPF lifetime p50/p99/LARGE% (or "-" where the
+// column can't be resolved to a (major,minor) with eBPF samples) next to the
+// zpool-reported LARGE% and op count for the same device.
+func renderCorrelated(state *State) {
+	devices, err := fetchZpoolIostat()
+	if err != nil {
+		log.Printf("correlate: zpool iostat: %v", err)
+		return
+	}
+	cols := buildZpoolColumns(devices)
+	stats, _, _ := state.Snapshot()
+
+	fmt.Printf("%-8s │ %8s %8s %8s │ %8s %8s\n", "DEVICE", "ebpf-p50", "ebpf-p99", "ebpf-LG%", "zfs-LG%", "zfs-ops")
+	fmt.Println(strings.Repeat("-", 70))
+	for _, c := range cols {
+		if c.Total == 0 {
+			continue
+		}
+		ebpfP50, ebpfP99, ebpfLarge := "-", "-", "-"
+		if dev, ok := resolveVdevDev(c.SampleName); ok {
+			if ds, ok := stats[dev]; ok && ds.lifetime.TotalCount() > 0 {
+				h := ds.lifetime
+				ebpfP50 = formatLatency(h.ValueAtQuantile(50))
+				ebpfP99 = formatLatency(h.ValueAtQuantile(99))
+				largeUs := int64(33_000)
+				if c.IsSMR {
+					largeUs = 134_000
+				}
+				ebpfLarge = fmt.Sprintf("%.2f%%", 100-quantileAtValue(h, largeUs))
+			}
+		}
+		fmt.Printf("%-8s │ %8s %8s %8s │ %7.2f%% %8s\n",
+			c.Label, ebpfP50, ebpfP99, ebpfLarge, largePercent(c), formatCount(c.Total))
+	}
+}
+
+// resolveVdevDev resolves a zpool vdev leaf's /dev/disk/by-id name to a
+// (major,minor) device number: follows the symlink to its underlying
+// /dev/sdX (or partition), strips any partition suffix, then reads
+// /sys/block/<dev>/dev. A vdev stacked on a holder (dm/LUKS) would need an
+// extra /sys/block/*/holders walk to find the physical disk underneath;
+// this only follows direct sdX/nvmeXnY targets, which covers this host's
+// layout.
+func resolveVdevDev(vdevName string) (uint32, bool) {
+	if vdevName == "" {
+		return 0, false
+	}
+	target, err := filepath.EvalSymlinks(filepath.Join("/dev/disk/by-id", vdevName))
+	if err != nil {
+		return 0, false
+	}
+	dev := stripBlockPartitionSuffix(filepath.Base(target))
+
+	data, err := os.ReadFile(filepath.Join("/sys/block", dev, "dev"))
+	if err != nil {
+		return 0, false
+	}
+	parts := strings.SplitN(strings.TrimSpace(string(data)), ":", 2)
+	if len(parts) != 2 {
+		return 0, false
+	}
+	major, err1 := strconv.ParseUint(parts[0], 10, 32)
+	minor, err2 := strconv.ParseUint(parts[1], 10, 32)
+	if err1 != nil || err2 != nil {
+		return 0, false
+	}
+	return majorMinorToDev(uint32(major), uint32(minor)), true
+}
+
+// stripBlockPartitionSuffix strips a trailing partition number from a block
+// device name (sdc1 -> sdc, nvme0n1p3 -> nvme0n1).
+func stripBlockPartitionSuffix(dev string) string {
+	if strings.HasPrefix(dev, "nvme") {
+		if i := strings.LastIndex(dev, "p"); i > 0 {
+			if _, err := strconv.Atoi(dev[i+1:]); err == nil {
+				return dev[:i]
+			}
+		}
+		return dev
+	}
+	i := len(dev)
+	for i > 0 && dev[i-1] >= '0' && dev[i-1] <= '9' {
+		i--
+	}
+	return dev[:i]
+}
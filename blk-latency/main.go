@@ -1,20 +1,33 @@
 // blk-latency: Per-IO latency percentile tracker using eBPF
 //
-// Traces block_rq_issue/complete to compute per-request latency,
-// maintains HDR histograms per device, emits percentiles on interval.
+// Traces block_rq_insert/issue/complete to compute per-request queue and
+// service latency, maintains HDR histograms per device, emits percentiles
+// on interval. Subcommands: `live` (interactive tracer + optional
+// /metrics, /hdr, -state persistence, and -slo burn-rate alerting with
+// BPF-side outlier tracing), `zpool` (the former standalone zpool_iostat
+// tool), `correlate` (both at once, joined by device), and `replay`
+// (reconstructs the display from a -state directory, no tracer).
 //
-//go:generate go run github.com/cilium/ebpf/cmd/bpf2go -cc clang -target bpfel -type latency_event bpf bpf/latency.c -- -I/usr/include -I.
+//go:generate go run github.com/cilium/ebpf/cmd/bpf2go -cc clang -target bpfel -type latency_event -type outlier_event bpf bpf/latency.c -- -I/usr/include -I.
 
 package main
 
 import (
 	"bytes"
+	"compress/gzip"
+	"encoding/base64"
 	"encoding/binary"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"path"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -37,17 +50,116 @@ const (
 )
 
 var (
-	interval   = flag.Duration("i", 10*time.Second, "stats interval for interval view")
-	devices    = flag.String("d", "", "comma-separated device filter (e.g., sdc,sdd or 8:32,8:48)")
-	batch      = flag.Bool("batch", false, "batch mode (no screen clearing)")
+	interval     = flag.Duration("i", 10*time.Second, "stats interval for interval view")
+	devices      = flag.String("d", "", "comma-separated device filter (e.g., sdc,sdd or 8:32,8:48)")
+	batch        = flag.Bool("batch", false, "batch mode (no screen clearing)")
+	cgroupGlobs  = flag.String("cgroup", "", "comma-separated cgroup glob filter (e.g. system.slice/*,machine.slice/*)")
+	by           = flag.String("by", "device", "display pivot: device (default) or cgroup")
+	listenAddr   = flag.String("listen", "", "address to serve /metrics and /hdr on (e.g. :9101); empty disables it")
+	hdrLogPath   = flag.String("hdr-log", "", "file to continuously append the HDR compressed histogram log to; empty disables it")
+	stateDir     = flag.String("state", "", "directory to persist lifetime histograms to (survives restarts); empty disables it")
+	slo          = flag.String("slo", "", "comma-separated latency objectives, e.g. p99=5ms,p99.9=20ms; empty disables burn-rate alerting")
+	alertWebhook = flag.String("alert-webhook", "", "URL to POST JSON alert events to; empty sends them to stderr")
 )
 
+// hdrBucketBoundsUs are the `le` bucket boundaries (in microseconds) used to
+// approximate a Prometheus classic histogram from an HDR histogram's
+// quantile function - a 1-2-5 geometric ladder from 1µs to 50s. Real
+// OpenMetrics native (sparse) histograms use an exponential-schema protobuf
+// wire format; this hand-rolled text exporter (matching the rest of this
+// repo's Prometheus collectors) approximates it with classic buckets instead.
+var hdrBucketBoundsUs = []int64{
+	1, 2, 5, 10, 20, 50, 100, 200, 500,
+	1_000, 2_000, 5_000, 10_000, 20_000, 50_000, 100_000, 200_000, 500_000,
+	1_000_000, 2_000_000, 5_000_000, 10_000_000, 20_000_000, 50_000_000,
+}
+
 // Device names cache: dev -> name
 var (
 	devNames   = make(map[uint32]string)
 	devNamesMu sync.RWMutex
 )
 
+// cgroupRoot is the v2 unified cgroup mountpoint. On v2, a cgroup's
+// directory inode number is exactly the ID bpf_get_current_cgroup_id()
+// returns in-kernel, so resolving an event's cgroup is a single map lookup
+// once the hierarchy below cgroupRoot has been walked.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroup ID -> path cache, built once at startup
+var (
+	cgroupPaths   = make(map[uint64]string)
+	cgroupPathsMu sync.RWMutex
+)
+
+// buildCgroupPathCache walks the cgroup v2 hierarchy once, indexing every
+// directory by its inode number.
+func buildCgroupPathCache() {
+	filepath.WalkDir(cgroupRoot, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		st, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil
+		}
+		rel, err := filepath.Rel(cgroupRoot, p)
+		if err != nil {
+			return nil
+		}
+		if rel == "." {
+			rel = "/"
+		}
+		cgroupPathsMu.Lock()
+		cgroupPaths[st.Ino] = rel
+		cgroupPathsMu.Unlock()
+		return nil
+	})
+}
+
+func lookupCgroupPath(id uint64) string {
+	cgroupPathsMu.RLock()
+	p, ok := cgroupPaths[id]
+	cgroupPathsMu.RUnlock()
+	if ok {
+		return p
+	}
+	return fmt.Sprintf("cgroup-%d", id)
+}
+
+// parseCgroupFilter splits a comma-separated list of glob patterns.
+func parseCgroupFilter(filter string) []string {
+	if filter == "" {
+		return nil
+	}
+	var patterns []string
+	for _, p := range strings.Split(filter, ",") {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// cgroupMatches reports whether cgroupPath matches any of patterns (or
+// patterns is empty, meaning no filtering).
+func cgroupMatches(patterns []string, cgroupPath string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, err := path.Match(p, cgroupPath); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
 // formatLatency formats a latency value (in µs) to human-readable string
 func formatLatency(us int64) string {
 	if us < 1000 {
@@ -66,6 +178,18 @@ func formatLatencyPadded(us int64) string {
 	return fmt.Sprintf("%8s", formatLatency(us))
 }
 
+// clampLatencyUs clamps a latency value (in µs) to the HDR histogram's
+// configured range, as RecordValue requires.
+func clampLatencyUs(us int64) int64 {
+	if us < 1 {
+		return 1
+	}
+	if us > histMax {
+		return histMax
+	}
+	return us
+}
+
 // formatCount formats sample counts
 func formatCount(n int64) string {
 	if n >= 1_000_000_000 {
@@ -192,36 +316,212 @@ func parseDeviceFilter(filter string) ([]uint32, error) {
 	return devs, nil
 }
 
-// deviceStats holds both interval and lifetime histograms for a device
+// reqOp classifies a request's op (the low REQ_OP_BITS bits of cmd_flags,
+// per include/linux/blk_types.h) into the handful of kinds worth splitting
+// latency by.
+type reqOp int
+
+const (
+	opRead reqOp = iota
+	opWrite
+	opFlush
+	opDiscard
+	opOther
+	opKindCount
+)
+
+func (o reqOp) String() string {
+	switch o {
+	case opRead:
+		return "read"
+	case opWrite:
+		return "write"
+	case opFlush:
+		return "flush"
+	case opDiscard:
+		return "discard"
+	default:
+		return "other"
+	}
+}
+
+// cmd_flags bit layout, from include/linux/blk_types.h: the op occupies the
+// low REQ_OP_BITS bits, REQ_SYNC/REQ_META are independent flag bits above it.
+const (
+	reqOpBits    = 8
+	reqOpMask    = (1 << reqOpBits) - 1
+	reqOpRead    = 0
+	reqOpWrite   = 1
+	reqOpFlush   = 2
+	reqOpDiscard = 3
+	reqSyncBit   = 1 << (reqOpBits + 3)
+	reqMetaBit   = 1 << (reqOpBits + 4)
+)
+
+func classifyOp(cmdFlags uint32) reqOp {
+	switch cmdFlags & reqOpMask {
+	case reqOpRead:
+		return opRead
+	case reqOpWrite:
+		return opWrite
+	case reqOpFlush:
+		return opFlush
+	case reqOpDiscard:
+		return opDiscard
+	default:
+		return opOther
+	}
+}
+
+// reqPhase splits a request's lifetime into time spent queued (waiting to
+// be dispatched) versus time spent in service (dispatched to completion).
+type reqPhase int
+
+const (
+	phaseQueue reqPhase = iota
+	phaseService
+	phaseCount
+)
+
+func (p reqPhase) String() string {
+	if p == phaseQueue {
+		return "queue"
+	}
+	return "service"
+}
+
+// histPair is an interval/lifetime histogram pair, the unit cell of the
+// (op, phase) breakdown matrix below.
+type histPair struct {
+	interval *hdrhistogram.Histogram
+	lifetime *hdrhistogram.Histogram
+}
+
+func newHistPair() *histPair {
+	return &histPair{
+		interval: hdrhistogram.New(histMin, histMax, histSigFig),
+		lifetime: hdrhistogram.New(histMin, histMax, histSigFig),
+	}
+}
+
+func (hp *histPair) Record(us int64) {
+	hp.interval.RecordValue(us)
+	hp.lifetime.RecordValue(us)
+}
+
+func (hp *histPair) ResetInterval() {
+	hp.interval.Reset()
+}
+
+func (hp *histPair) Snapshot() *histPair {
+	return &histPair{
+		interval: hdrhistogram.Import(hp.interval.Export()),
+		lifetime: hdrhistogram.Import(hp.lifetime.Export()),
+	}
+}
+
+// cgroupStats mirrors deviceStats but scoped to one cgroup within a device,
+// backing the per-cgroup breakdown table rendered under each device.
+type cgroupStats struct {
+	interval *hdrhistogram.Histogram
+	lifetime *hdrhistogram.Histogram
+}
+
+func newCgroupStats() *cgroupStats {
+	return &cgroupStats{
+		interval: hdrhistogram.New(histMin, histMax, histSigFig),
+		lifetime: hdrhistogram.New(histMin, histMax, histSigFig),
+	}
+}
+
+func (cs *cgroupStats) Record(latencyUs int64) {
+	cs.interval.RecordValue(latencyUs)
+	cs.lifetime.RecordValue(latencyUs)
+}
+
+func (cs *cgroupStats) ResetInterval() {
+	cs.interval.Reset()
+}
+
+func (cs *cgroupStats) Snapshot() *cgroupStats {
+	return &cgroupStats{
+		interval: hdrhistogram.Import(cs.interval.Export()),
+		lifetime: hdrhistogram.Import(cs.lifetime.Export()),
+	}
+}
+
+// deviceStats holds both interval and lifetime histograms for a device's
+// total (queue+service) latency, a per-cgroup breakdown of the same, and a
+// finer (op, phase) breakdown matrix - mirroring the total_wait/disk_wait,
+// read/write split already surfaced by `zpool iostat -wv`.
 type deviceStats struct {
-	interval *hdrhistogram.Histogram // Current interval (reset each period)
-	lifetime *hdrhistogram.Histogram // All-time accumulation
+	interval  *hdrhistogram.Histogram // Current interval (reset each period)
+	lifetime  *hdrhistogram.Histogram // All-time accumulation
+	byCgroup  map[string]*cgroupStats // cgroup path -> stats, scoped to this device
+	byOpPhase [opKindCount][phaseCount]*histPair
 }
 
 func newDeviceStats() *deviceStats {
-	return &deviceStats{
+	ds := &deviceStats{
 		interval: hdrhistogram.New(histMin, histMax, histSigFig),
 		lifetime: hdrhistogram.New(histMin, histMax, histSigFig),
+		byCgroup: make(map[string]*cgroupStats),
 	}
+	for op := range ds.byOpPhase {
+		for phase := range ds.byOpPhase[op] {
+			ds.byOpPhase[op][phase] = newHistPair()
+		}
+	}
+	return ds
 }
 
-// Record adds a latency sample to both histograms
-func (ds *deviceStats) Record(latencyUs int64) {
-	ds.interval.RecordValue(latencyUs)
-	ds.lifetime.RecordValue(latencyUs)
+// Record adds a (queueUs, serviceUs) sample: their sum goes into the
+// device's aggregate and cgroup-breakdown histograms (for backward-compatible
+// single-number views), while each phase is also recorded separately into
+// the op/phase breakdown matrix.
+func (ds *deviceStats) Record(queueUs, serviceUs int64, cgroupPath string, op reqOp) {
+	totalUs := queueUs + serviceUs
+	ds.interval.RecordValue(totalUs)
+	ds.lifetime.RecordValue(totalUs)
+	cs, ok := ds.byCgroup[cgroupPath]
+	if !ok {
+		cs = newCgroupStats()
+		ds.byCgroup[cgroupPath] = cs
+	}
+	cs.Record(totalUs)
+	ds.byOpPhase[op][phaseQueue].Record(queueUs)
+	ds.byOpPhase[op][phaseService].Record(serviceUs)
 }
 
-// ResetInterval clears the interval histogram (lifetime persists)
+// ResetInterval clears the interval histograms (lifetime persists)
 func (ds *deviceStats) ResetInterval() {
 	ds.interval.Reset()
+	for _, cs := range ds.byCgroup {
+		cs.ResetInterval()
+	}
+	for op := range ds.byOpPhase {
+		for phase := range ds.byOpPhase[op] {
+			ds.byOpPhase[op][phase].ResetInterval()
+		}
+	}
 }
 
-// Snapshot creates deep copies of both histograms for lock-free display
+// Snapshot creates deep copies of every histogram for lock-free display
 func (ds *deviceStats) Snapshot() *deviceStats {
-	return &deviceStats{
+	cp := &deviceStats{
 		interval: hdrhistogram.Import(ds.interval.Export()),
 		lifetime: hdrhistogram.Import(ds.lifetime.Export()),
+		byCgroup: make(map[string]*cgroupStats, len(ds.byCgroup)),
+	}
+	for cgroupPath, cs := range ds.byCgroup {
+		cp.byCgroup[cgroupPath] = cs.Snapshot()
 	}
+	for op := range ds.byOpPhase {
+		for phase := range ds.byOpPhase[op] {
+			cp.byOpPhase[op][phase] = ds.byOpPhase[op][phase].Snapshot()
+		}
+	}
+	return cp
 }
 
 // State holds all device stats with mutex protection
@@ -241,14 +541,14 @@ func newState() *State {
 	}
 }
 
-func (s *State) Record(dev uint32, latencyUs int64) {
+func (s *State) Record(dev uint32, cgroupPath string, op reqOp, queueUs, serviceUs int64) {
 	s.mu.Lock()
 	ds, ok := s.stats[dev]
 	if !ok {
 		ds = newDeviceStats()
 		s.stats[dev] = ds
 	}
-	ds.Record(latencyUs)
+	ds.Record(queueUs, serviceUs, cgroupPath, op)
 	s.mu.Unlock()
 }
 
@@ -283,6 +583,27 @@ func (d *Display) resetCursor() {
 	}
 }
 
+// writeStatsRow formats one label's latency histogram as a table row.
+func writeStatsRow(buf *strings.Builder, label string, h *hdrhistogram.Histogram) {
+	n := h.TotalCount()
+	if n == 0 {
+		fmt.Fprintf(buf, "%-10s │ %8s %8s %8s %8s %8s %8s %8s │ %9s\n",
+			label, "-", "-", "-", "-", "-", "-", "-", "0")
+		return
+	}
+	fmt.Fprintf(buf, "%-10s │ %s %s %s %s %s %s %s │ %9s\n",
+		label,
+		formatLatencyPadded(int64(h.Mean())),
+		formatLatencyPadded(h.ValueAtQuantile(50)),
+		formatLatencyPadded(h.ValueAtQuantile(90)),
+		formatLatencyPadded(h.ValueAtQuantile(95)),
+		formatLatencyPadded(h.ValueAtQuantile(99)),
+		formatLatencyPadded(h.ValueAtQuantile(99.9)),
+		formatLatencyPadded(h.Max()),
+		formatCount(n),
+	)
+}
+
 func (d *Display) render(stats map[uint32]*deviceStats, startTime, lastReset time.Time, intervalDur time.Duration) {
 	var buf strings.Builder
 	now := time.Now()
@@ -313,26 +634,7 @@ func (d *Display) render(stats map[uint32]*deviceStats, startTime, lastReset tim
 
 	// Interval stats
 	for _, dev := range devList {
-		ds := stats[dev]
-		name := lookupDevName(dev)
-		h := ds.interval
-		n := h.TotalCount()
-		if n == 0 {
-			fmt.Fprintf(&buf, "%-10s │ %8s %8s %8s %8s %8s %8s %8s │ %9s\n",
-				name, "-", "-", "-", "-", "-", "-", "-", "0")
-			continue
-		}
-		fmt.Fprintf(&buf, "%-10s │ %s %s %s %s %s %s %s │ %9s\n",
-			name,
-			formatLatencyPadded(int64(h.Mean())),
-			formatLatencyPadded(h.ValueAtQuantile(50)),
-			formatLatencyPadded(h.ValueAtQuantile(90)),
-			formatLatencyPadded(h.ValueAtQuantile(95)),
-			formatLatencyPadded(h.ValueAtQuantile(99)),
-			formatLatencyPadded(h.ValueAtQuantile(99.9)),
-			formatLatencyPadded(h.Max()),
-			formatCount(n),
-		)
+		writeStatsRow(&buf, lookupDevName(dev), stats[dev].interval)
 	}
 
 	buf.WriteString("\n")
@@ -345,31 +647,84 @@ func (d *Display) render(stats map[uint32]*deviceStats, startTime, lastReset tim
 	var totalSamples int64
 	for _, dev := range devList {
 		ds := stats[dev]
-		name := lookupDevName(dev)
-		h := ds.lifetime
-		n := h.TotalCount()
-		totalSamples += n
-		if n == 0 {
-			fmt.Fprintf(&buf, "%-10s │ %8s %8s %8s %8s %8s %8s %8s │ %9s\n",
-				name, "-", "-", "-", "-", "-", "-", "-", "0")
-			continue
-		}
-		fmt.Fprintf(&buf, "%-10s │ %s %s %s %s %s %s %s │ %9s\n",
-			name,
-			formatLatencyPadded(int64(h.Mean())),
-			formatLatencyPadded(h.ValueAtQuantile(50)),
-			formatLatencyPadded(h.ValueAtQuantile(90)),
-			formatLatencyPadded(h.ValueAtQuantile(95)),
-			formatLatencyPadded(h.ValueAtQuantile(99)),
-			formatLatencyPadded(h.ValueAtQuantile(99.9)),
-			formatLatencyPadded(h.Max()),
-			formatCount(n),
-		)
+		writeStatsRow(&buf, lookupDevName(dev), ds.lifetime)
+		totalSamples += ds.lifetime.TotalCount()
 	}
 
 	buf.WriteString(strings.Repeat("=", 120))
 	buf.WriteString("\n")
 
+	// Per-cgroup breakdown, one sub-table per device with >1 cgroup seen
+	for _, dev := range devList {
+		ds := stats[dev]
+		if len(ds.byCgroup) < 2 {
+			continue
+		}
+		var cgroupPaths []string
+		for cgroupPath := range ds.byCgroup {
+			cgroupPaths = append(cgroupPaths, cgroupPath)
+		}
+		sort.Strings(cgroupPaths)
+
+		fmt.Fprintf(&buf, "\n%s by cgroup:\n", lookupDevName(dev))
+		fmt.Fprintf(&buf, "%-10s │ %8s %8s %8s │ %9s\n", "CGROUP", "p50", "p95", "p99", "samples")
+		buf.WriteString(strings.Repeat("-", 120))
+		buf.WriteString("\n")
+		for _, cgroupPath := range cgroupPaths {
+			h := ds.byCgroup[cgroupPath].lifetime
+			n := h.TotalCount()
+			if n == 0 {
+				fmt.Fprintf(&buf, "%-10s │ %8s %8s %8s │ %9s\n", cgroupPath, "-", "-", "-", "0")
+				continue
+			}
+			fmt.Fprintf(&buf, "%-10s │ %s %s %s │ %9s\n",
+				cgroupPath,
+				formatLatencyPadded(h.ValueAtQuantile(50)),
+				formatLatencyPadded(h.ValueAtQuantile(95)),
+				formatLatencyPadded(h.ValueAtQuantile(99)),
+				formatCount(n),
+			)
+		}
+	}
+
+	// Per-(op,phase) breakdown, one sub-table per device where more than one
+	// op kind has been observed - collapsed (omitted) otherwise since it adds
+	// nothing over the aggregate table above.
+	for _, dev := range devList {
+		ds := stats[dev]
+		var opsSeen int
+		for op := range ds.byOpPhase {
+			if ds.byOpPhase[op][phaseQueue].lifetime.TotalCount()+ds.byOpPhase[op][phaseService].lifetime.TotalCount() > 0 {
+				opsSeen++
+			}
+		}
+		if opsSeen < 2 {
+			continue
+		}
+
+		fmt.Fprintf(&buf, "\n%s by op/phase:\n", lookupDevName(dev))
+		fmt.Fprintf(&buf, "%-16s │ %8s %8s %8s │ %9s\n", "OP/PHASE", "p50", "p95", "p99", "samples")
+		buf.WriteString(strings.Repeat("-", 120))
+		buf.WriteString("\n")
+		for op := reqOp(0); op < opKindCount; op++ {
+			for phase := reqPhase(0); phase < phaseCount; phase++ {
+				h := ds.byOpPhase[op][phase].lifetime
+				n := h.TotalCount()
+				if n == 0 {
+					continue
+				}
+				label := fmt.Sprintf("%s-%s", op, phase)
+				fmt.Fprintf(&buf, "%-16s │ %s %s %s │ %9s\n",
+					label,
+					formatLatencyPadded(h.ValueAtQuantile(50)),
+					formatLatencyPadded(h.ValueAtQuantile(95)),
+					formatLatencyPadded(h.ValueAtQuantile(99)),
+					formatCount(n),
+				)
+			}
+		}
+	}
+
 	// Stats summary
 	rate := float64(0)
 	if elapsed.Seconds() > 0 {
@@ -386,69 +741,469 @@ func (d *Display) render(stats map[uint32]*deviceStats, startTime, lastReset tim
 	fmt.Print(buf.String())
 }
 
-func main() {
-	flag.Parse()
+// renderByCgroup pivots the display to cgroup-major/device-minor: one
+// section per cgroup, listing the lifetime latency of each device it was
+// observed issuing I/O on.
+func (d *Display) renderByCgroup(stats map[uint32]*deviceStats, startTime time.Time, intervalDur time.Duration) {
+	var buf strings.Builder
+	now := time.Now()
 
-	// Parse device filter
-	filterDevs, err := parseDeviceFilter(*devices)
+	byCgroup := make(map[string]map[uint32]*hdrhistogram.Histogram)
+	for dev, ds := range stats {
+		for cgroupPath, cs := range ds.byCgroup {
+			devs, ok := byCgroup[cgroupPath]
+			if !ok {
+				devs = make(map[uint32]*hdrhistogram.Histogram)
+				byCgroup[cgroupPath] = devs
+			}
+			devs[dev] = cs.lifetime
+		}
+	}
+
+	var cgroupPaths []string
+	for cgroupPath := range byCgroup {
+		cgroupPaths = append(cgroupPaths, cgroupPath)
+	}
+	sort.Strings(cgroupPaths)
+
+	timestamp := now.Format("15:04:05")
+	elapsed := now.Sub(startTime)
+	fmt.Fprintf(&buf, "Block I/O Latency Monitor (by cgroup) - %s (uptime: %s, interval: %s)\n",
+		timestamp, formatDuration(elapsed), formatDuration(intervalDur))
+	buf.WriteString(strings.Repeat("=", 120))
+	buf.WriteString("\n")
+
+	for _, cgroupPath := range cgroupPaths {
+		devs := byCgroup[cgroupPath]
+		var devList []uint32
+		for dev := range devs {
+			devList = append(devList, dev)
+		}
+		sort.Slice(devList, func(i, j int) bool {
+			return lookupDevName(devList[i]) < lookupDevName(devList[j])
+		})
+
+		fmt.Fprintf(&buf, "%s\n", cgroupPath)
+		fmt.Fprintf(&buf, "%-10s │ %8s %8s %8s %8s %8s %8s %8s │ %9s\n",
+			"DEVICE", "avg", "p50", "p90", "p95", "p99", "p99.9", "max", "samples")
+		buf.WriteString(strings.Repeat("-", 120))
+		buf.WriteString("\n")
+		for _, dev := range devList {
+			writeStatsRow(&buf, lookupDevName(dev), devs[dev])
+		}
+		buf.WriteString("\n")
+	}
+
+	d.resetCursor()
+	fmt.Print(buf.String())
+}
+
+// quantileAtValue returns the fraction (0-100) of samples at or below value,
+// found by binary-searching h's (monotonic) quantile function - the inverse
+// of ValueAtQuantile. Used to approximate classic-histogram bucket counts
+// from an HDR histogram without relying on any lower-level HDR internals.
+func quantileAtValue(h *hdrhistogram.Histogram, value int64) float64 {
+	lo, hi := 0.0, 100.0
+	for i := 0; i < 30; i++ {
+		mid := (lo + hi) / 2
+		if h.ValueAtQuantile(mid) <= value {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+// devLabels formats a device's Prometheus labels: device, major, minor.
+func devLabels(dev uint32, extra string) string {
+	major, minor := devToMajorMinor(dev)
+	if extra == "" {
+		return fmt.Sprintf("device=\"%s\",major=\"%d\",minor=\"%d\"", lookupDevName(dev), major, minor)
+	}
+	return fmt.Sprintf("device=\"%s\",major=\"%d\",minor=\"%d\",%s", lookupDevName(dev), major, minor, extra)
+}
+
+// promCollector renders the current device (and per-cgroup) HDR snapshots
+// as Prometheus text exposition. It calls state.Snapshot() exactly once per
+// scrape - the same lock-free-after-copy pattern used by the queue-depth
+// exporter in usb-queue-monitor-v2.go - then formats the response afterward.
+type promCollector struct {
+	state *State
+}
+
+func (pc *promCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	stats, _, _ := pc.state.Snapshot()
+
+	var devList []uint32
+	for dev := range stats {
+		devList = append(devList, dev)
+	}
+	sort.Slice(devList, func(i, j int) bool { return lookupDevName(devList[i]) < lookupDevName(devList[j]) })
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	fmt.Fprintln(w, "# HELP blk_latency_seconds Block I/O request latency, lifetime distribution.")
+	fmt.Fprintln(w, "# TYPE blk_latency_seconds histogram")
+	for _, dev := range devList {
+		h := stats[dev].lifetime
+		total := h.TotalCount()
+		for _, boundUs := range hdrBucketBoundsUs {
+			count := int64(quantileAtValue(h, boundUs) / 100.0 * float64(total))
+			fmt.Fprintf(w, "blk_latency_seconds_bucket{%s} %d\n", devLabels(dev, fmt.Sprintf("le=\"%s\"", formatSeconds(boundUs))), count)
+		}
+		fmt.Fprintf(w, "blk_latency_seconds_bucket{%s} %d\n", devLabels(dev, "le=\"+Inf\""), total)
+		fmt.Fprintf(w, "blk_latency_seconds_sum{%s} %f\n", devLabels(dev, ""), h.Mean()*float64(total)/1_000_000)
+		fmt.Fprintf(w, "blk_latency_seconds_count{%s} %d\n", devLabels(dev, ""), total)
+
+		for cgroupPath, cs := range stats[dev].byCgroup {
+			cgTotal := cs.lifetime.TotalCount()
+			fmt.Fprintf(w, "blk_latency_seconds_count{%s} %d\n", devLabels(dev, fmt.Sprintf("cgroup=%q", cgroupPath)), cgTotal)
+		}
+	}
+}
+
+// formatSeconds renders a microsecond bucket bound as a Prometheus `le`
+// value in fractional seconds (Prometheus convention regardless of the
+// metric's native unit).
+func formatSeconds(us int64) string {
+	return strconv.FormatFloat(float64(us)/1_000_000, 'g', -1, 64)
+}
+
+// hdrLogEntry is one interval's worth of a device's HDR histogram, encoded
+// for the /hdr endpoint and the -hdr-log file.
+type hdrLogEntry struct {
+	Dev       uint32 `json:"dev"`
+	Device    string `json:"device"`
+	StartTime int64  `json:"start_time"` // unix nanos
+	EndTime   int64  `json:"end_time"`   // unix nanos
+	Histogram string `json:"histogram"`  // base64(gzip(json(hdrhistogram.Snapshot)))
+}
+
+// encodeHDRSnapshot gzip-compresses and base64-encodes an HDR histogram
+// snapshot. This is a simplified, JSON-based encoding in the spirit of the
+// HDR Compressed Histogram Log v1.3 format rather than a byte-for-byte
+// reimplementation of its Java wire format, since this Go HDR library
+// doesn't implement that codec.
+func encodeHDRSnapshot(h *hdrhistogram.Histogram) (string, error) {
+	raw, err := json.Marshal(h.Export())
 	if err != nil {
-		log.Fatalf("Invalid device filter: %v", err)
+		return "", err
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(raw); err != nil {
+		return "", err
 	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// hdrLog accumulates bounded per-device HDR log entries in memory (for the
+// /hdr endpoint) and optionally appends each entry as a line to -hdr-log.
+type hdrLog struct {
+	mu      sync.Mutex
+	entries map[uint32][]hdrLogEntry
+	path    string
+	maxKept int
+}
+
+func newHDRLog(path string) *hdrLog {
+	return &hdrLog{entries: make(map[uint32][]hdrLogEntry), path: path, maxKept: 500}
+}
 
-	// Remove memlock limit for eBPF
+// append records one device's just-completed interval histogram. Call this
+// right before State.ResetIntervals() clears it.
+func (l *hdrLog) append(dev uint32, start, end time.Time, h *hdrhistogram.Histogram) {
+	encoded, err := encodeHDRSnapshot(h)
+	if err != nil {
+		log.Printf("hdr-log: failed to encode %s: %v", lookupDevName(dev), err)
+		return
+	}
+	entry := hdrLogEntry{
+		Dev:       dev,
+		Device:    lookupDevName(dev),
+		StartTime: start.UnixNano(),
+		EndTime:   end.UnixNano(),
+		Histogram: encoded,
+	}
+
+	l.mu.Lock()
+	kept := append(l.entries[dev], entry)
+	if len(kept) > l.maxKept {
+		kept = kept[len(kept)-l.maxKept:]
+	}
+	l.entries[dev] = kept
+	l.mu.Unlock()
+
+	if l.path == "" {
+		return
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("hdr-log: failed to open %s: %v", l.path, err)
+		return
+	}
+	defer f.Close()
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(f, "%s\n", line)
+}
+
+func (l *hdrLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintln(w, "#[Histogram log format version 1.3 (simplified JSON encoding)]")
+	fmt.Fprintf(w, "#[StartTime: %.3f (seconds since epoch)]\n", float64(time.Now().UnixNano())/1e9)
+	fmt.Fprintln(w, `"StartTimestamp","EndTimestamp","Device","Compressed_Histogram"`)
+
+	var devList []uint32
+	for dev := range l.entries {
+		devList = append(devList, dev)
+	}
+	sort.Slice(devList, func(i, j int) bool { return lookupDevName(devList[i]) < lookupDevName(devList[j]) })
+	for _, dev := range devList {
+		for _, e := range l.entries[dev] {
+			fmt.Fprintf(w, "%.3f,%.3f,%q,%s\n",
+				float64(e.StartTime)/1e9, float64(e.EndTime)/1e9, e.Device, e.Histogram)
+		}
+	}
+}
+
+// tracer owns the eBPF resources and the ring-buffer decode loop that feeds
+// a State, shared by the `live` and `correlate` subcommands so neither has
+// to duplicate eBPF setup/teardown or event decoding.
+type tracer struct {
+	objs      bpfObjects
+	links     []io.Closer
+	rd        *ringbuf.Reader
+	outlierRd *ringbuf.Reader
+	state     *State
+}
+
+func startTracer(filterDevs []uint32) (*tracer, error) {
 	if err := rlimit.RemoveMemlock(); err != nil {
-		log.Fatalf("Failed to remove memlock limit: %v", err)
+		return nil, fmt.Errorf("removing memlock limit: %w", err)
 	}
 
-	// Load eBPF objects
 	objs := bpfObjects{}
 	if err := loadBpfObjects(&objs, nil); err != nil {
-		log.Fatalf("Failed to load eBPF objects: %v", err)
+		return nil, fmt.Errorf("loading eBPF objects: %w", err)
 	}
-	defer objs.Close()
 
-	// Set up device filter if specified
 	if len(filterDevs) > 0 {
 		var key uint32 = 0
 		var enabled uint8 = 1
 		if err := objs.LatConfig.Put(key, enabled); err != nil {
-			log.Fatalf("Failed to enable filter: %v", err)
+			objs.Close()
+			return nil, fmt.Errorf("enabling filter: %w", err)
 		}
 		for _, dev := range filterDevs {
 			var val uint8 = 1
 			if err := objs.DevFilter.Put(dev, val); err != nil {
-				log.Fatalf("Failed to add device to filter: %v", err)
+				objs.Close()
+				return nil, fmt.Errorf("adding device to filter: %w", err)
 			}
 		}
 		log.Printf("Filtering %d device(s)", len(filterDevs))
 	}
 
-	// Attach to tracepoints
-	tpIssue, err := link.AttachTracing(link.TracingOptions{
-		Program: objs.BlockRqIssue,
-	})
+	tpInsert, err := link.AttachTracing(link.TracingOptions{Program: objs.BlockRqInsert})
 	if err != nil {
-		log.Fatalf("Failed to attach block_rq_issue: %v", err)
+		objs.Close()
+		return nil, fmt.Errorf("attaching block_rq_insert: %w", err)
 	}
-	defer tpIssue.Close()
-
-	tpComplete, err := link.AttachTracing(link.TracingOptions{
-		Program: objs.BlockRqComplete,
-	})
+	tpIssue, err := link.AttachTracing(link.TracingOptions{Program: objs.BlockRqIssue})
+	if err != nil {
+		tpInsert.Close()
+		objs.Close()
+		return nil, fmt.Errorf("attaching block_rq_issue: %w", err)
+	}
+	tpComplete, err := link.AttachTracing(link.TracingOptions{Program: objs.BlockRqComplete})
 	if err != nil {
-		log.Fatalf("Failed to attach block_rq_complete: %v", err)
+		tpInsert.Close()
+		tpIssue.Close()
+		objs.Close()
+		return nil, fmt.Errorf("attaching block_rq_complete: %w", err)
 	}
-	defer tpComplete.Close()
 
-	// Open ring buffer
 	rd, err := ringbuf.NewReader(objs.Events)
 	if err != nil {
-		log.Fatalf("Failed to open ring buffer: %v", err)
+		tpInsert.Close()
+		tpIssue.Close()
+		tpComplete.Close()
+		objs.Close()
+		return nil, fmt.Errorf("opening ring buffer: %w", err)
+	}
+
+	outlierRd, err := ringbuf.NewReader(objs.Outliers)
+	if err != nil {
+		rd.Close()
+		tpInsert.Close()
+		tpIssue.Close()
+		tpComplete.Close()
+		objs.Close()
+		return nil, fmt.Errorf("opening outlier ring buffer: %w", err)
+	}
+
+	return &tracer{
+		objs:      objs,
+		links:     []io.Closer{tpInsert, tpIssue, tpComplete},
+		rd:        rd,
+		outlierRd: outlierRd,
+		state:     newState(),
+	}, nil
+}
+
+func (t *tracer) Close() {
+	t.rd.Close()
+	t.outlierRd.Close()
+	for _, l := range t.links {
+		l.Close()
+	}
+	t.objs.Close()
+}
+
+// setOutlierThreshold updates the dynamic per-device outlier_threshold BPF
+// map entry that block_rq_complete checks, so the kernel only emits an
+// outlier event once latency for that device crosses the current threshold
+// instead of userspace filtering every latency_event after the fact.
+func (t *tracer) setOutlierThreshold(dev uint32, thresholdNs uint64) error {
+	return t.objs.OutlierThreshold.Put(dev, thresholdNs)
+}
+
+// consumeOutliers runs the outlier ring-buffer decode loop until done is
+// closed, handing each decoded record to sink (normally outlierTracker.add).
+// The BPF side only emits into this ringbuf for devices with a non-zero
+// outlier_threshold (see setOutlierThreshold / updateOutlierThresholds).
+func (t *tracer) consumeOutliers(done <-chan struct{}, sink func(dev uint32, rec outlierRecord)) {
+	var event bpfOutlierEvent
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		record, err := t.outlierRd.Read()
+		if err != nil {
+			if err == ringbuf.ErrClosed {
+				return
+			}
+			continue
+		}
+
+		if err := binary.Read(bytes.NewReader(record.RawSample), binary.LittleEndian, &event); err != nil {
+			continue
+		}
+
+		sink(event.Dev, outlierRecord{
+			When:      time.Now(),
+			Comm:      commString(event.Comm),
+			Pid:       event.Pid,
+			Sector:    event.Sector,
+			NrSectors: event.NrSectors,
+			Op:        classifyOp(event.OpFlags),
+			LatencyUs: clampLatencyUs(int64(event.LatencyNs / 1000)),
+		})
 	}
-	defer rd.Close()
+}
 
-	state := newState()
+// consume runs the ring buffer decode loop until done is closed or the
+// reader is closed out from under it (via Close).
+func (t *tracer) consume(done <-chan struct{}, cgroupFilter []string) {
+	var event bpfLatencyEvent
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		record, err := t.rd.Read()
+		if err != nil {
+			if err == ringbuf.ErrClosed {
+				return
+			}
+			continue
+		}
+
+		if err := binary.Read(bytes.NewReader(record.RawSample), binary.LittleEndian, &event); err != nil {
+			continue
+		}
+
+		// Only track nvme* and sd* devices
+		devName := lookupDevName(event.Dev)
+		if !isTrackedDevice(devName) {
+			continue
+		}
+
+		cgroupPath := lookupCgroupPath(event.CgroupId)
+		if !cgroupMatches(cgroupFilter, cgroupPath) {
+			continue
+		}
+
+		queueUs := clampLatencyUs(int64(event.QueueNs / 1000))
+		serviceUs := clampLatencyUs(int64(event.ServiceNs / 1000))
+
+		t.state.Record(event.Dev, cgroupPath, classifyOp(event.OpFlags), queueUs, serviceUs)
+	}
+}
+
+// runLive is the `blk-latency live` subcommand: the original interactive
+// tracer (TUI + optional /metrics, /hdr, -hdr-log).
+func runLive(args []string) {
+	flag.CommandLine.Parse(args)
+
+	// Parse device filter
+	filterDevs, err := parseDeviceFilter(*devices)
+	if err != nil {
+		log.Fatalf("Invalid device filter: %v", err)
+	}
+	cgroupFilter := parseCgroupFilter(*cgroupGlobs)
+
+	if *by != "device" && *by != "cgroup" {
+		log.Fatalf("Invalid -by value: %s (want device or cgroup)", *by)
+	}
+
+	sloTargets, err := parseSLO(*slo)
+	if err != nil {
+		log.Fatalf("Invalid -slo: %v", err)
+	}
+
+	buildCgroupPathCache()
+
+	t, err := startTracer(filterDevs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer t.Close()
+
+	state := t.state
 	display := &Display{batchMode: *batch}
+	hlog := newHDRLog(*hdrLogPath)
+
+	if *stateDir != "" {
+		state.SeedLifetime(loadState(*stateDir))
+	}
+
+	if *listenAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", &promCollector{state: state})
+		mux.Handle("/hdr", hlog)
+		go func() {
+			log.Printf("Serving /metrics and /hdr on %s", *listenAddr)
+			if err := http.ListenAndServe(*listenAddr, mux); err != nil {
+				log.Printf("HTTP server stopped: %v", err)
+			}
+		}()
+	}
 
 	// Signal handling
 	done := make(chan struct{})
@@ -471,12 +1226,30 @@ func main() {
 			case <-displayTicker.C:
 				stats, startTime, lastReset := state.Snapshot()
 				if len(stats) > 0 {
-					display.render(stats, startTime, lastReset, *interval)
+					if *by == "cgroup" {
+						display.renderByCgroup(stats, startTime, *interval)
+					} else {
+						display.render(stats, startTime, lastReset, *interval)
+					}
 				}
 			}
 		}
 	}()
 
+	// SLO burn-rate alerting: a ring of past interval histograms (to
+	// reconstruct the multi-window burn rates), an outlier tracker fed from
+	// the BPF outlier ringbuf, a threshold updater that keeps the BPF side's
+	// per-dev outlier_threshold map current, and the evaluator itself.
+	var burnSamples *burnRing
+	var outliers *outlierTracker
+	if len(sloTargets) > 0 {
+		burnSamples = newBurnRing(longestBurnWindow())
+		outliers = newOutlierTracker(50)
+		go t.consumeOutliers(done, outliers.add)
+		go updateOutlierThresholds(t, state, *interval, done)
+		go evalBurnRates(burnSamples, state, sloTargets, outliers, *alertWebhook, done)
+	}
+
 	// Interval reset goroutine
 	intervalTicker := time.NewTicker(*interval)
 	go func() {
@@ -486,51 +1259,74 @@ func main() {
 			case <-done:
 				return
 			case <-intervalTicker.C:
+				stats, _, lastReset := state.Snapshot()
+				now := time.Now()
+				for dev, ds := range stats {
+					hlog.append(dev, lastReset, now, ds.interval)
+					if burnSamples != nil {
+						burnSamples.add(dev, lastReset, now, ds.interval)
+					}
+				}
 				state.ResetIntervals()
 			}
 		}
 	}()
 
-	log.Printf("Tracing block I/O latency (interval=%v, display=10fps)...", *interval)
-
-	// Ring buffer consumer (main loop)
-	var event bpfLatencyEvent
-	for {
-		select {
-		case <-done:
-			// Final stats
-			stats, startTime, lastReset := state.Snapshot()
-			display.render(stats, startTime, lastReset, *interval)
-			return
-		default:
-		}
-
-		record, err := rd.Read()
-		if err != nil {
-			if err == ringbuf.ErrClosed {
-				return
+	// State rotation goroutine: periodically checkpoints every device's
+	// lifetime histogram to -state so a restart doesn't lose it.
+	if *stateDir != "" {
+		rotateTicker := time.NewTicker(stateRotateInterval)
+		go func() {
+			defer rotateTicker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-rotateTicker.C:
+					stats, startTime, _ := state.Snapshot()
+					saveState(*stateDir, stats, startTime, time.Now().UnixNano())
+				}
 			}
-			continue
-		}
+		}()
+	}
 
-		if err := binary.Read(bytes.NewReader(record.RawSample), binary.LittleEndian, &event); err != nil {
-			continue
-		}
+	log.Printf("Tracing block I/O latency (interval=%v, display=10fps)...", *interval)
 
-		// Only track nvme* and sd* devices
-		devName := lookupDevName(event.Dev)
-		if !isTrackedDevice(devName) {
-			continue
-		}
+	// Ring buffer decode loop (main loop); returns when done is closed.
+	t.consume(done, cgroupFilter)
 
-		latencyUs := int64(event.LatencyNs / 1000)
-		if latencyUs < 1 {
-			latencyUs = 1
-		}
-		if latencyUs > histMax {
-			latencyUs = histMax
-		}
+	if *stateDir != "" {
+		stats, startTime, _ := state.Snapshot()
+		saveState(*stateDir, stats, startTime, time.Now().UnixNano())
+	}
+
+	stats, startTime, lastReset := state.Snapshot()
+	if *by == "cgroup" {
+		display.renderByCgroup(stats, startTime, *interval)
+	} else {
+		display.render(stats, startTime, lastReset, *interval)
+	}
+}
 
-		state.Record(event.Dev, latencyUs)
+// main dispatches to the live, zpool, correlate, and replay subcommands -
+// folded into one binary (chunk3-4) so correlate can reuse both the eBPF
+// tracer and the zpool_iostat parser directly instead of shelling out to two
+// tools.
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal("usage: blk-latency <live|zpool|correlate|replay> [flags]")
+	}
+	cmd, args := os.Args[1], os.Args[2:]
+	switch cmd {
+	case "live":
+		runLive(args)
+	case "zpool":
+		runZpool(args)
+	case "correlate":
+		runCorrelate(args)
+	case "replay":
+		runReplay(args)
+	default:
+		log.Fatalf("unknown subcommand %q (want live, zpool, correlate, or replay)", cmd)
 	}
 }
@@ -0,0 +1,240 @@
+package main
+
+// state.go: `-state <dir>` lifetime persistence and the `blk-latency replay
+// <dir>` subcommand (chunk3-5). The lifetime histogram is otherwise lost on
+// process restart, defeating its purpose on long-running hosts: this
+// periodically (and on shutdown) serializes each device's lifetime
+// histogram to a versioned file, and on startup loads and merges whatever
+// matches the current device set back in.
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+const (
+	stateMagic          = "blk-latency-state"
+	stateVersion        = 1
+	stateRotateInterval = time.Hour
+)
+
+// persistedDeviceState is one device's on-disk lifetime-histogram snapshot.
+type persistedDeviceState struct {
+	Magic     string `json:"magic"`
+	Version   int    `json:"version"`
+	Dev       uint32 `json:"dev"`
+	Device    string `json:"device"`
+	StartTime int64  `json:"start_time"` // unix nanos
+	EndTime   int64  `json:"end_time"`   // unix nanos
+	Histogram string `json:"histogram"`  // base64(gzip(json(hdrhistogram.Export())))
+	SHA256    string `json:"sha256"`     // hex sha256 of the pre-compression JSON bytes
+}
+
+// encodeHistogramWithHash is encodeHDRSnapshot plus a content hash, so
+// loadState can detect a truncated/corrupt state file instead of silently
+// importing a garbage histogram.
+func encodeHistogramWithHash(h *hdrhistogram.Histogram) (encoded, hash string, err error) {
+	raw, err := json.Marshal(h.Export())
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256(raw)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(raw); err != nil {
+		return "", "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), hex.EncodeToString(sum[:]), nil
+}
+
+// decodeHistogram reverses encodeHistogramWithHash, verifying wantHash
+// (skipped if empty).
+func decodeHistogram(encoded, wantHash string) (*hdrhistogram.Histogram, error) {
+	compressed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decoding base64: %w", err)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("opening gzip: %w", err)
+	}
+	raw, err := io.ReadAll(gz)
+	if err != nil {
+		return nil, fmt.Errorf("decompressing: %w", err)
+	}
+	if wantHash != "" {
+		sum := sha256.Sum256(raw)
+		if hex.EncodeToString(sum[:]) != wantHash {
+			return nil, fmt.Errorf("sha256 mismatch, state file is corrupt")
+		}
+	}
+	var snap hdrhistogram.Snapshot
+	if err := json.Unmarshal(raw, &snap); err != nil {
+		return nil, fmt.Errorf("unmarshaling snapshot: %w", err)
+	}
+	return hdrhistogram.Import(&snap), nil
+}
+
+func stateFilePath(dir string, dev uint32, seq int64) string {
+	return filepath.Join(dir, fmt.Sprintf("%s.%d.json", lookupDevName(dev), seq))
+}
+
+// saveState persists every device's current lifetime histogram to dir as a
+// new versioned file (seq = unix nanos of the save), so loadState (on the
+// next startup) and `blk-latency replay` can reconstruct history without
+// the live tracer.
+func saveState(dir string, stats map[uint32]*deviceStats, startTime time.Time, seq int64) {
+	if dir == "" {
+		return
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("state: failed to create %s: %v", dir, err)
+		return
+	}
+	for dev, ds := range stats {
+		encoded, hash, err := encodeHistogramWithHash(ds.lifetime)
+		if err != nil {
+			log.Printf("state: failed to encode %s: %v", lookupDevName(dev), err)
+			continue
+		}
+		rec := persistedDeviceState{
+			Magic:     stateMagic,
+			Version:   stateVersion,
+			Dev:       dev,
+			Device:    lookupDevName(dev),
+			StartTime: startTime.UnixNano(),
+			EndTime:   seq,
+			Histogram: encoded,
+			SHA256:    hash,
+		}
+		data, err := json.MarshalIndent(rec, "", "  ")
+		if err != nil {
+			continue
+		}
+		path := stateFilePath(dir, dev, seq)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			log.Printf("state: failed to write %s: %v", path, err)
+		}
+	}
+}
+
+func readStateFile(path string) (*persistedDeviceState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rec persistedDeviceState
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("parsing json: %w", err)
+	}
+	if rec.Magic != stateMagic {
+		return nil, fmt.Errorf("bad magic %q", rec.Magic)
+	}
+	if rec.Version != stateVersion {
+		return nil, fmt.Errorf("unsupported version %d", rec.Version)
+	}
+	return &rec, nil
+}
+
+// loadState loads every state file in dir and merges each device's files
+// into a single lifetime histogram per device (hdrhistogram.Import + Merge),
+// for State.SeedLifetime on startup or `blk-latency replay` to render
+// directly.
+func loadState(dir string) map[uint32]*hdrhistogram.Histogram {
+	merged := make(map[uint32]*hdrhistogram.Histogram)
+	if dir == "" {
+		return merged
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("state: failed to read %s: %v", dir, err)
+		}
+		return merged
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		rec, err := readStateFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			log.Printf("state: skipping %s: %v", entry.Name(), err)
+			continue
+		}
+		h, err := decodeHistogram(rec.Histogram, rec.SHA256)
+		if err != nil {
+			log.Printf("state: skipping %s: %v", entry.Name(), err)
+			continue
+		}
+		if existing, ok := merged[rec.Dev]; ok {
+			existing.Merge(h)
+		} else {
+			merged[rec.Dev] = h
+		}
+	}
+	if len(merged) > 0 {
+		log.Printf("state: restored lifetime history for %d device(s) from %s", len(merged), dir)
+	}
+	return merged
+}
+
+// SeedLifetime merges previously-persisted lifetime histograms (from
+// loadState) into freshly created device stats, so lifetime percentiles
+// survive a process restart.
+func (s *State) SeedLifetime(seed map[uint32]*hdrhistogram.Histogram) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for dev, h := range seed {
+		ds, ok := s.stats[dev]
+		if !ok {
+			ds = newDeviceStats()
+			s.stats[dev] = ds
+		}
+		ds.lifetime.Merge(h)
+	}
+}
+
+// runReplay is the `blk-latency replay <dir>` subcommand: it reconstructs
+// the display purely from saved state files, with no tracer running.
+func runReplay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		log.Fatal("usage: blk-latency replay <dir>")
+	}
+	dir := fs.Arg(0)
+
+	merged := loadState(dir)
+	if len(merged) == 0 {
+		log.Fatalf("no state files found in %s", dir)
+	}
+
+	stats := make(map[uint32]*deviceStats)
+	for dev, h := range merged {
+		ds := newDeviceStats()
+		ds.lifetime.Merge(h)
+		stats[dev] = ds
+	}
+
+	now := time.Now()
+	display := &Display{batchMode: true}
+	display.render(stats, now, now, 0)
+}
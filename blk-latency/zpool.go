@@ -0,0 +1,307 @@
+package main
+
+// zpool.go: the `blk-latency zpool` subcommand - parses `zpool iostat -wv`
+// latency-bucket output into the same fixed-device-layout summary table the
+// standalone zpool_iostat tool used to print, now folded into this binary
+// per chunk3-4 so `correlate` can reuse the same parser against the eBPF
+// view without shelling out to a second tool.
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// allLatencies lists every latency bucket `zpool iostat -wv` reports, in order.
+var allLatencies = []string{
+	"1ns", "3ns", "7ns", "15ns", "31ns", "63ns", "127ns", "255ns", "511ns",
+	"1us", "2us", "4us", "8us", "16us", "32us", "65us", "131us", "262us", "524us",
+	"1ms", "2ms", "4ms", "8ms", "16ms", "33ms", "67ms", "134ms", "268ms", "536ms",
+	"1s", "2s", "4s", "8s", "17s", "34s", "68s", "137s",
+}
+
+// displayLatencies is the subset of allLatencies printed in the table.
+var displayLatencies = allLatencies
+
+// SMR "large" starts at 134ms, others at 33ms
+var smrLargeStart = "134ms"
+var defaultLargeStart = "33ms"
+
+// DeviceData is one `zpool iostat -wv` leaf device's latency histogram.
+type DeviceData struct {
+	Name    string
+	Latency map[string]int64
+	Total   int64
+}
+
+var zpoolHeaderPattern = regexp.MustCompile(`^(\S+)\s+total_wait`)
+var zpoolLatencyPattern = regexp.MustCompile(`^([\d\.]+(?:ns|us|ms|s))\s+(.+)`)
+
+// fetchZpoolIostat runs `zpool iostat -wv` and parses its per-device latency
+// histogram output into DeviceData records.
+func fetchZpoolIostat() ([]DeviceData, error) {
+	cmd := exec.Command("zpool", "iostat", "-wv")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("creating pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("running zpool: %w", err)
+	}
+
+	var devices []DeviceData
+	var currentDevice *DeviceData
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if matches := zpoolHeaderPattern.FindStringSubmatch(line); matches != nil {
+			if currentDevice != nil {
+				devices = append(devices, *currentDevice)
+			}
+			currentDevice = &DeviceData{
+				Name:    matches[1],
+				Latency: make(map[string]int64),
+			}
+			continue
+		}
+
+		if currentDevice != nil {
+			if matches := zpoolLatencyPattern.FindStringSubmatch(line); matches != nil {
+				latency := matches[1]
+				fields := strings.Fields(matches[2])
+				if len(fields) >= 4 {
+					r := parseCount(fields[2])
+					w := parseCount(fields[3])
+					currentDevice.Latency[latency] = r + w
+					currentDevice.Total += r + w
+				}
+			}
+		}
+	}
+	if currentDevice != nil {
+		devices = append(devices, *currentDevice)
+	}
+
+	return devices, cmd.Wait()
+}
+
+// zpoolColDef declares one summary-table column as a label plus the set of
+// device short names (see shortName) that roll up into it.
+type zpoolColDef struct {
+	label string
+	keys  []string
+	isSMR bool
+}
+
+// zpoolCols is the fixed device layout for this host: sda, nvme0, nvme1,
+// sdb-sdg (USB Seagates).
+var zpoolCols = []zpoolColDef{
+	{"sda", []string{"sda-p4", "sda-p5", "sda-p6"}, false},
+	{"nvme0", []string{"nvme0"}, false},
+	{"nvme1", []string{"nvme1"}, false},
+	{"sdb", []string{"sdb"}, true},
+	{"sdc", []string{"sdc"}, true},
+	{"sdd", []string{"sdd"}, true},
+	{"sde", []string{"sde"}, true},
+	{"sdf", []string{"sdf"}, true},
+	{"sdg", []string{"sdg"}, true},
+}
+
+// ZpoolColData is one summary-table column's rolled-up latency histogram.
+type ZpoolColData struct {
+	Label      string
+	Total      int64
+	Latency    map[string]int64
+	IsSMR      bool
+	SampleName string // one matched leaf's raw /dev/disk/by-id name, for dev-number resolution (see resolveVdevDev)
+}
+
+// buildZpoolColumns rolls up parsed per-device histograms into the fixed
+// column layout (zpoolCols), keyed by shortName.
+func buildZpoolColumns(devices []DeviceData) []ZpoolColData {
+	devMap := make(map[string]*DeviceData)
+	for i := range devices {
+		d := &devices[i]
+		if short := shortName(d.Name); short != "" {
+			devMap[short] = d
+		}
+	}
+
+	var cols []ZpoolColData
+	for _, col := range zpoolCols {
+		cd := ZpoolColData{Label: col.label, Latency: make(map[string]int64), IsSMR: col.isSMR}
+		for _, key := range col.keys {
+			if d, ok := devMap[key]; ok {
+				cd.Total += d.Total
+				if cd.SampleName == "" {
+					cd.SampleName = d.Name
+				}
+				for lat, count := range d.Latency {
+					cd.Latency[lat] += count
+				}
+			}
+		}
+		cols = append(cols, cd)
+	}
+	return cols
+}
+
+// largeStartBucket returns the latency bucket label a column's "LARGE"
+// tail starts at.
+func largeStartBucket(isSMR bool) string {
+	if isSMR {
+		return smrLargeStart
+	}
+	return defaultLargeStart
+}
+
+// largePercent returns the fraction of c's samples at or above its LARGE
+// threshold, as a percentage.
+func largePercent(c ZpoolColData) float64 {
+	if c.Total == 0 {
+		return 0
+	}
+	startLat := largeStartBucket(c.IsSMR)
+	largeSum := int64(0)
+	inLarge := false
+	for _, lat := range allLatencies {
+		if lat == startLat {
+			inLarge = true
+		}
+		if inLarge {
+			largeSum += c.Latency[lat]
+		}
+	}
+	return float64(largeSum) / float64(c.Total) * 100
+}
+
+// printZpoolTable renders the bucket-percentage summary table, identical to
+// the standalone zpool_iostat tool this subcommand replaces.
+func printZpoolTable(cols []ZpoolColData) {
+	fmt.Printf("%-8s", "latency")
+	for _, c := range cols {
+		fmt.Printf(" %7s", c.Label)
+	}
+	fmt.Println()
+	fmt.Println(strings.Repeat("-", 8+8*len(cols)))
+
+	for _, lat := range displayLatencies {
+		fmt.Printf("%-8s", lat)
+		for _, c := range cols {
+			if c.Total == 0 {
+				fmt.Printf(" %7s", "-")
+				continue
+			}
+			pct := float64(c.Latency[lat]) / float64(c.Total) * 100
+			if pct >= 0.01 {
+				fmt.Printf(" %6.2f%%", pct)
+			} else {
+				fmt.Printf(" %7s", "-")
+			}
+		}
+		fmt.Println()
+	}
+
+	fmt.Println(strings.Repeat("-", 8+8*len(cols)))
+	fmt.Printf("%-8s", "LARGE")
+	for _, c := range cols {
+		if c.Total == 0 {
+			fmt.Printf(" %7s", "-")
+			continue
+		}
+		fmt.Printf(" %6.2f%%", largePercent(c))
+	}
+	fmt.Println()
+
+	fmt.Printf("%-8s", "total")
+	for _, c := range cols {
+		switch {
+		case c.Total == 0:
+			fmt.Printf(" %7s", "-")
+		case c.Total >= 1000000:
+			fmt.Printf(" %6.1fM", float64(c.Total)/1000000)
+		case c.Total >= 1000:
+			fmt.Printf(" %6.1fK", float64(c.Total)/1000)
+		default:
+			fmt.Printf(" %7d", c.Total)
+		}
+	}
+	fmt.Println()
+
+	fmt.Printf("\nLARGE: flash (sda/nvme) >= 33ms (~4x), SMR (sdb-sdg) >= 134ms\n")
+}
+
+// parseCount parses a `zpool iostat` operation count, which may carry a
+// K/M/G suffix.
+func parseCount(s string) int64 {
+	s = strings.TrimSpace(s)
+	if s == "0" {
+		return 0
+	}
+
+	multiplier := int64(1)
+	if strings.HasSuffix(s, "K") {
+		multiplier = 1000
+		s = s[:len(s)-1]
+	} else if strings.HasSuffix(s, "M") {
+		multiplier = 1000000
+		s = s[:len(s)-1]
+	} else if strings.HasSuffix(s, "G") {
+		multiplier = 1000000000
+		s = s[:len(s)-1]
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return int64(f * float64(multiplier))
+}
+
+// shortName maps a zpool vdev leaf's by-id name to this host's short device
+// names (sda, nvme0, nvme1, sdb-sdg), or "" if unrecognized.
+func shortName(name string) string {
+	// wwn-0x5002538da01ceedd-part4/5/6 -> sda-p4/p5/p6
+	if strings.HasPrefix(name, "wwn-0x5002538da01ceedd-part") {
+		part := strings.TrimPrefix(name, "wwn-0x5002538da01ceedd-part")
+		return "sda-p" + part
+	}
+	// nvme-WD_BLACK_SN770_2TB_245077404326-part1 -> nvme0
+	if strings.Contains(name, "245077404326") {
+		return "nvme0"
+	}
+	// nvme-WD_BLACK_SN770_2TB_24493Z401591 -> nvme1
+	if strings.Contains(name, "24493Z401591") {
+		return "nvme1"
+	}
+	// USB Seagates -> sdb, sdc, sdd, sde, sdf, sdg
+	usbMap := map[string]string{
+		"NT17FBP5": "sdc",
+		"NT17FBQC": "sdd",
+		"NT17FC6F": "sde",
+		"NT17FC7Z": "sdf",
+		"NT17DHQR": "sdg",
+		// sdb - add serial when known
+	}
+	for serial, sd := range usbMap {
+		if strings.Contains(name, serial) {
+			return sd
+		}
+	}
+	return ""
+}
+
+// runZpool is the `blk-latency zpool` subcommand: fetch, roll up, print.
+func runZpool(args []string) {
+	devices, err := fetchZpoolIostat()
+	if err != nil {
+		log.Fatalf("zpool iostat: %v", err)
+	}
+	printZpoolTable(buildZpoolColumns(devices))
+}
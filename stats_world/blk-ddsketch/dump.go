@@ -0,0 +1,201 @@
+package main
+
+// dump.go: --dump/--dump-interval periodically snapshot every device's
+// sketches to disk (chunk6-3), so `merge` (see merge.go) can recombine them
+// later - e.g. a day of 10s dumps, or one dump per node in a cluster - into
+// a single global table via Sketch.Merge, without re-running the trace.
+//
+// Each dump is a pair of files sharing a "<host>-<device>[-<cgroup>]-<unixts>"
+// stem: a ".sketch" blob (this package's own length-prefixed binary format,
+// built on Sketch.MarshalBinary) and a ".json" sidecar describing it.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// dumpSidecar is the small JSON sidecar written next to every .sketch blob;
+// merge reads it to know how to decode the blob and how to group it with
+// others for the same (device, cgroup). Dumps of one (device, cgroup) whose
+// sketch config differs are not kept apart: merge stops with an error.
+type dumpSidecar struct {
+	Host          string    `json:"host"`
+	Device        string    `json:"device"`
+	CgroupPath    string    `json:"cgroup_path,omitempty"`
+	SketchKind    string    `json:"sketch_kind"`
+	SketchParam   float64   `json:"sketch_param"` // alpha (ddsketch) or compression (tdigest)
+	IntervalCount uint64    `json:"interval_count"`
+	LifetimeCount uint64    `json:"lifetime_count"`
+	StartTime     time.Time `json:"start_time"`
+	LastReset     time.Time `json:"last_reset"`
+	DumpedAt      time.Time `json:"dumped_at"`
+}
+
+// runDumper snapshots state every dumpInterval and writes one .sketch/.json
+// pair per device (or device+cgroup row) under dir, until done is closed.
+func runDumper(state *State, dir string, dumpInterval time.Duration, sketchKind string, sketchParam float64, done <-chan struct{}) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Fatalf("--dump: failed to create %s: %v", dir, err)
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	ticker := time.NewTicker(dumpInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			dumpSnapshot(state, dir, host, sketchKind, sketchParam)
+		}
+	}
+}
+
+func dumpSnapshot(state *State, dir, host, sketchKind string, sketchParam float64) {
+	stats, startTime, lastReset := state.Snapshot()
+	// Record keeps op/size split; fold them so each stem gets one device (and cgroup) row.
+	stats = foldStats(stats, false, false)
+	now := time.Now()
+	for key, ds := range stats {
+		stem := host + "-" + sanitizeForFilename(lookupDevName(key.dev))
+		if key.cgroupID != 0 {
+			stem += "-" + sanitizeForFilename(lookupCgroupPath(key.cgroupID))
+		}
+		stem += fmt.Sprintf("-%d", now.Unix())
+
+		if err := writeSketchBlob(filepath.Join(dir, stem+".sketch"), ds); err != nil {
+			log.Printf("--dump: failed to write %s: %v", stem, err)
+			continue
+		}
+
+		sidecar := dumpSidecar{
+			Host:          host,
+			Device:        lookupDevName(key.dev),
+			SketchKind:    sketchKind,
+			SketchParam:   sketchParam,
+			IntervalCount: ds.intervalPrecise.count,
+			LifetimeCount: ds.lifetimePrecise.count,
+			StartTime:     startTime,
+			LastReset:     lastReset,
+			DumpedAt:      now,
+		}
+		if key.cgroupID != 0 {
+			sidecar.CgroupPath = lookupCgroupPath(key.cgroupID)
+		}
+		if err := writeJSON(filepath.Join(dir, stem+".json"), sidecar); err != nil {
+			log.Printf("--dump: failed to write sidecar for %s: %v", stem, err)
+		}
+	}
+}
+
+func sanitizeForFilename(s string) string {
+	return strings.NewReplacer("/", "_", " ", "_").Replace(strings.Trim(s, "/"))
+}
+
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func readSidecar(path string) (dumpSidecar, error) {
+	var sc dumpSidecar
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return sc, err
+	}
+	if err := json.Unmarshal(data, &sc); err != nil {
+		return sc, fmt.Errorf("%s: %w", path, err)
+	}
+	return sc, nil
+}
+
+// sketchBlobMagic tags .sketch files so merge fails fast on the wrong file
+// instead of misinterpreting arbitrary bytes as sketch data.
+const sketchBlobMagic = "BDDS1\n"
+
+// writeSketchBlob encodes ds.lifetime then ds.interval as
+// magic + (uint32 length-prefixed MarshalBinary blob) pairs.
+func writeSketchBlob(path string, ds *deviceStats) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(sketchBlobMagic); err != nil {
+		return err
+	}
+	for _, s := range []Sketch{ds.lifetime, ds.interval} {
+		data, err := s.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		if err := binary.Write(f, binary.LittleEndian, uint32(len(data))); err != nil {
+			return err
+		}
+		if _, err := f.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSketchBlob decodes a blob written by writeSketchBlob, creating both
+// sketches through newSketchFunc - the caller must have already pointed
+// newSketchFunc at a factory matching the blob's sidecar (kind, param).
+func readSketchBlob(path string) (lifetime, interval Sketch, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !bytes.HasPrefix(data, []byte(sketchBlobMagic)) {
+		return nil, nil, fmt.Errorf("%s: not a blk-ddsketch .sketch blob", path)
+	}
+	data = data[len(sketchBlobMagic):]
+
+	next := func() ([]byte, error) {
+		if len(data) < 4 {
+			return nil, fmt.Errorf("%s: truncated blob", path)
+		}
+		n := binary.LittleEndian.Uint32(data[:4])
+		data = data[4:]
+		if uint32(len(data)) < n {
+			return nil, fmt.Errorf("%s: truncated blob", path)
+		}
+		chunk := data[:n]
+		data = data[n:]
+		return chunk, nil
+	}
+
+	lifetimeBytes, err := next()
+	if err != nil {
+		return nil, nil, err
+	}
+	intervalBytes, err := next()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lifetime = newSketchFunc()
+	if err := lifetime.UnmarshalBinary(lifetimeBytes); err != nil {
+		return nil, nil, fmt.Errorf("%s: lifetime: %w", path, err)
+	}
+	interval = newSketchFunc()
+	if err := interval.UnmarshalBinary(intervalBytes); err != nil {
+		return nil, nil, fmt.Errorf("%s: interval: %w", path, err)
+	}
+	return lifetime, interval, nil
+}
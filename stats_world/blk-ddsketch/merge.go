@@ -0,0 +1,196 @@
+package main
+
+// merge.go: the `blk-ddsketch merge <dump-stems...>` subcommand (chunk6-3),
+// dispatched from main() the same way blk-latency's main() dispatches
+// live/zpool/correlate/replay. It recombines --dump snapshots - a day of
+// 10s dumps, or one dump per node in a cluster - into the same
+// interval/lifetime table runLive prints, via Sketch.Merge, so operators
+// get a true global p99.999 without re-running the trace.
+
+import (
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// mergedRow accumulates every dump matching one (device, cgroup) key.
+type mergedRow struct {
+	key                  statsKey
+	sketchKind           string
+	sketchParam          float64
+	interval, lifetime   Sketch
+	intervalN, lifetimeN uint64
+	startTime, lastReset time.Time
+}
+
+// runMerge is the `blk-ddsketch merge` subcommand.
+func runMerge(args []string) {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	mergeBatch := fs.Bool("batch", false, "batch mode (no screen clearing)")
+	fs.Parse(args)
+
+	stems := dumpStems(fs.Args())
+	if len(stems) == 0 {
+		log.Fatal("usage: blk-ddsketch merge <dump-stem-or-.json-or-.sketch-file>...")
+	}
+
+	rows := make(map[statsKey]*mergedRow)
+	devIDs := make(map[string]uint32)
+
+	for _, stem := range stems {
+		sidecar, err := readSidecar(stem + ".json")
+		if err != nil {
+			log.Fatalf("merge: %v", err)
+		}
+
+		// readSketchBlob decodes through newSketchFunc, so point it at a
+		// factory matching this specific blob's own sidecar before every
+		// read - dumps being merged don't all have to share one backend,
+		// only each (device, cgroup) row does (checked below).
+		factory, _, err := configureSketch(sidecar.SketchKind, sidecar.SketchParam, sidecar.SketchParam)
+		if err != nil {
+			log.Fatalf("merge: %s: %v", stem, err)
+		}
+		newSketchFunc = factory
+
+		lifetime, interval, err := readSketchBlob(stem + ".sketch")
+		if err != nil {
+			log.Fatalf("merge: %v", err)
+		}
+
+		key := mergeKey(devIDs, sidecar)
+		row, ok := rows[key]
+		if !ok {
+			row = &mergedRow{
+				key:         key,
+				sketchKind:  sidecar.SketchKind,
+				sketchParam: sidecar.SketchParam,
+				interval:    newSketchFunc(),
+				lifetime:    newSketchFunc(),
+				startTime:   sidecar.StartTime,
+				lastReset:   sidecar.LastReset,
+			}
+			rows[key] = row
+		} else if row.sketchKind != sidecar.SketchKind || row.sketchParam != sidecar.SketchParam {
+			log.Fatalf("merge: %s: sketch config %s/%.4f doesn't match earlier dumps for %s (%s/%.4f)",
+				stem, sidecar.SketchKind, sidecar.SketchParam, sidecar.Device, row.sketchKind, row.sketchParam)
+		}
+
+		if err := row.lifetime.Merge(lifetime); err != nil {
+			log.Fatalf("merge: %s: %v", stem, err)
+		}
+		if err := row.interval.Merge(interval); err != nil {
+			log.Fatalf("merge: %s: %v", stem, err)
+		}
+		row.lifetimeN += sidecar.LifetimeCount
+		row.intervalN += sidecar.IntervalCount
+		if sidecar.StartTime.Before(row.startTime) {
+			row.startTime = sidecar.StartTime
+		}
+		if sidecar.LastReset.After(row.lastReset) {
+			row.lastReset = sidecar.LastReset
+		}
+	}
+
+	stats := make(map[statsKey]*deviceStats, len(rows))
+	var startTime, lastReset time.Time
+	showCgroup := false
+	for key, row := range rows {
+		stats[key] = &deviceStats{
+			interval:        row.interval,
+			lifetime:        row.lifetime,
+			intervalPrecise: preciseStats{count: row.intervalN},
+			lifetimePrecise: preciseStats{count: row.lifetimeN},
+		}
+		if startTime.IsZero() || row.startTime.Before(startTime) {
+			startTime = row.startTime
+		}
+		if row.lastReset.After(lastReset) {
+			lastReset = row.lastReset
+		}
+		if key.cgroupID != 0 {
+			showCgroup = true
+		}
+	}
+
+	display := &Display{batchMode: *mergeBatch, showCgroup: showCgroup}
+	_, sketchLabel, _ := configureSketch(stems.firstKind(), stems.firstParam(), stems.firstParam())
+	display.render(stats, startTime, lastReset, 0, sketchLabel)
+}
+
+// dumpStems normalizes a mix of bare stems, .json paths, and .sketch paths
+// into a deduplicated, sorted list of stems.
+type dumpStemSet []string
+
+func dumpStems(files []string) dumpStemSet {
+	seen := make(map[string]bool)
+	var stems dumpStemSet
+	for _, f := range files {
+		stem := strings.TrimSuffix(strings.TrimSuffix(f, ".json"), ".sketch")
+		if !seen[stem] {
+			seen[stem] = true
+			stems = append(stems, stem)
+		}
+	}
+	sort.Strings(stems)
+	return stems
+}
+
+// firstKind/firstParam re-read the first stem's sidecar purely to label the
+// merged display header; the sketches themselves were already validated
+// and merged in runMerge's main loop.
+func (s dumpStemSet) firstKind() string {
+	if len(s) == 0 {
+		return "ddsketch"
+	}
+	sc, err := readSidecar(s[0] + ".json")
+	if err != nil {
+		return "ddsketch"
+	}
+	return sc.SketchKind
+}
+
+func (s dumpStemSet) firstParam() float64 {
+	if len(s) == 0 {
+		return 0.01
+	}
+	sc, err := readSidecar(s[0] + ".json")
+	if err != nil {
+		return 0.01
+	}
+	return sc.SketchParam
+}
+
+// mergeKey maps a sidecar's (device, cgroup) strings onto a statsKey,
+// assigning each distinct device name a small synthetic dev id (there's no
+// real dev_t once sketches are on disk) and registering both into the
+// existing devNames/cgroupPaths caches so render() prints the real names.
+func mergeKey(devIDs map[string]uint32, sc dumpSidecar) statsKey {
+	devID, ok := devIDs[sc.Device]
+	if !ok {
+		devID = fnv32(sc.Device)
+		devIDs[sc.Device] = devID
+		devNamesMu.Lock()
+		devNames[devID] = sc.Device
+		devNamesMu.Unlock()
+	}
+
+	var cgroupID uint64
+	if sc.CgroupPath != "" {
+		cgroupID = uint64(fnv32(sc.CgroupPath))
+		cgroupPathsMu.Lock()
+		cgroupPaths[cgroupID] = sc.CgroupPath
+		cgroupPathsMu.Unlock()
+	}
+	return statsKey{dev: devID, cgroupID: cgroupID}
+}
+
+func fnv32(s string) uint32 {
+	h := fnv.New32a()
+	fmt.Fprint(h, s)
+	return h.Sum32()
+}
@@ -3,21 +3,33 @@
 // Traces syscall enter/exit to compute per-syscall latency,
 // maintains HDR histograms per syscall type, emits percentiles on interval.
 //
-// Usage: syscall-latency [-c comm] [-s syscalls] [-i interval]
+// Usage: syscall-latency [-c comm] [-s syscalls] [-i interval] [-prometheus] [-listen addr] [-hdrlog path] [-stack-threshold dur]
+//
+// With -stack-threshold set, syscall_latency.c also walks bpf_get_stackid()
+// into a BPF_MAP_TYPE_STACK_TRACE map (StackTraces) for any syscall slower
+// than the threshold, and latency_event gains kstack_id/ustack_id.
 //
 //go:generate go run github.com/cilium/ebpf/cmd/bpf2go -cc clang -target bpfel -type latency_event bpf bpf/syscall_latency.c -- -I/usr/include -I.
 
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"compress/zlib"
+	"encoding/base64"
 	"encoding/binary"
 	"flag"
 	"fmt"
 	"log"
+	"math"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -30,111 +42,285 @@ import (
 )
 
 const (
-	displayInterval = 100 * time.Millisecond // 10 FPS display refresh
-	histMin         = 1
-	histMax         = 60_000_000 // 60 seconds in µs
-	histSigFig      = 3
+	displayInterval    = 100 * time.Millisecond // 10 FPS display refresh
+	histMin            = 1
+	histMax            = 60_000_000 // 60 seconds in µs
+	histSigFig         = 3
+	defaultMetricsAddr = ":9477"
 )
 
 var (
-	interval    = flag.Duration("i", 10*time.Second, "stats reset interval")
-	processName = flag.String("c", "", "filter by process name (e.g., storagenode)")
-	syscallList = flag.String("s", "pread64,pwrite64,fsync,fdatasync,read,write", "comma-separated syscalls to trace")
-	batch       = flag.Bool("batch", false, "batch mode (no screen clearing)")
+	interval          = flag.Duration("i", 10*time.Second, "stats reset interval")
+	processName       = flag.String("c", "", "filter by process name (e.g., storagenode)")
+	syscallList       = flag.String("s", "pread64,pwrite64,fsync,fdatasync,read,write", "comma-separated syscalls to trace")
+	batch             = flag.Bool("batch", false, "batch mode (no screen clearing)")
+	prometheusEnabled = flag.Bool("prometheus", false, "serve a Prometheus /metrics endpoint (default "+defaultMetricsAddr+" unless -listen is set)")
+	listenAddr        = flag.String("listen", "", "address to serve Prometheus /metrics on (e.g. :9477); implies -prometheus")
+	archFlag          = flag.String("arch", runtime.GOARCH, "syscall number table to use: amd64, arm64, or arm (default: host arch; override for cross-analysis of data collected on another host)")
+	hdrLogPath        = flag.String("hdrlog", "", "write per-interval per-syscall histograms to this path in HdrHistogram interval-log format, for post-processing with HistogramLogAnalyzer/plotFiles")
+	stackThreshold    = flag.Duration("stack-threshold", 0, "capture kernel+user stacks for syscalls slower than this (0 disables stack capture)")
 )
 
-// x86_64 syscall numbers
-var syscallNums = map[string]uint32{
-	"read":      0,
-	"write":     1,
-	"open":      2,
-	"close":     3,
-	"stat":      4,
-	"fstat":     5,
-	"lstat":     6,
-	"poll":      7,
-	"lseek":     8,
-	"mmap":      9,
-	"mprotect":  10,
-	"munmap":    11,
-	"brk":       12,
-	"pread64":   17,
-	"pwrite64":  18,
-	"readv":     19,
-	"writev":    20,
-	"access":    21,
-	"pipe":      22,
-	"select":    23,
-	"dup":       32,
-	"dup2":      33,
-	"socket":    41,
-	"connect":   42,
-	"accept":    43,
-	"sendto":    44,
-	"recvfrom":  45,
-	"sendmsg":   46,
-	"recvmsg":   47,
-	"shutdown":  48,
-	"bind":      49,
-	"listen":    50,
-	"clone":     56,
-	"fork":      57,
-	"vfork":     58,
-	"execve":    59,
-	"exit":      60,
-	"wait4":     61,
-	"kill":      62,
-	"fcntl":     72,
-	"flock":     73,
-	"fsync":     74,
-	"fdatasync": 75,
-	"truncate":  76,
-	"ftruncate": 77,
-	"getdents":  78,
-	"getcwd":    79,
-	"chdir":     80,
-	"rename":    82,
-	"mkdir":     83,
-	"rmdir":     84,
-	"creat":     85,
-	"link":      86,
-	"unlink":    87,
-	"symlink":   88,
-	"readlink":  89,
-	"chmod":     90,
-	"fchmod":    91,
-	"chown":     92,
-	"fchown":    93,
-	"lchown":    94,
-	"umask":     95,
-	"openat":    257,
-	"mkdirat":   258,
-	"fstatat":   262,
-	"unlinkat":  263,
-	"renameat":  264,
-	"faccessat": 269,
-	"splice":    275,
-	"sync":      162,
-	"syncfs":    306,
-	"fallocate": 285,
-	"epoll_wait":    232,
-	"epoll_pwait":   281,
-	"futex":         202,
-	"nanosleep":     35,
-	"accept4":       288,
-	"recvmmsg":      299,
-	"sendmmsg":      307,
-}
-
-// Reverse map for display
-var syscallNames = make(map[uint32]string)
-
-func init() {
-	for name, num := range syscallNums {
-		syscallNames[num] = name
+// syscallTable maps syscall name to raw syscall number for one architecture.
+// Syscall numbers are not portable across architectures (and several legacy
+// names don't exist at all on some of them), so each arch gets its own table.
+type syscallTable map[string]uint32
+
+// syscallTables holds the name->number mapping for every architecture we
+// know about. amd64 retains the original x86_64 table; arm64 and arm use the
+// arm64 (generic asm-generic/unistd.h) and arm EABI tables respectively, so
+// legacy calls like open/fork/dup2 are simply absent where the arch has no
+// equivalent (e.g. arm64 has no open, only openat).
+var syscallTables = map[string]syscallTable{
+	"amd64": {
+		"read":      0,
+		"write":     1,
+		"open":      2,
+		"close":     3,
+		"stat":      4,
+		"fstat":     5,
+		"lstat":     6,
+		"poll":      7,
+		"lseek":     8,
+		"mmap":      9,
+		"mprotect":  10,
+		"munmap":    11,
+		"brk":       12,
+		"pread64":   17,
+		"pwrite64":  18,
+		"readv":     19,
+		"writev":    20,
+		"access":    21,
+		"pipe":      22,
+		"select":    23,
+		"dup":       32,
+		"dup2":      33,
+		"socket":    41,
+		"connect":   42,
+		"accept":    43,
+		"sendto":    44,
+		"recvfrom":  45,
+		"sendmsg":   46,
+		"recvmsg":   47,
+		"shutdown":  48,
+		"bind":      49,
+		"listen":    50,
+		"clone":     56,
+		"fork":      57,
+		"vfork":     58,
+		"execve":    59,
+		"exit":      60,
+		"wait4":     61,
+		"kill":      62,
+		"fcntl":     72,
+		"flock":     73,
+		"fsync":     74,
+		"fdatasync": 75,
+		"truncate":  76,
+		"ftruncate": 77,
+		"getdents":  78,
+		"getcwd":    79,
+		"chdir":     80,
+		"rename":    82,
+		"mkdir":     83,
+		"rmdir":     84,
+		"creat":     85,
+		"link":      86,
+		"unlink":    87,
+		"symlink":   88,
+		"readlink":  89,
+		"chmod":     90,
+		"fchmod":    91,
+		"chown":     92,
+		"fchown":    93,
+		"lchown":    94,
+		"umask":     95,
+		"openat":    257,
+		"mkdirat":   258,
+		"fstatat":   262,
+		"unlinkat":  263,
+		"renameat":  264,
+		"faccessat": 269,
+		"splice":    275,
+		"sync":      162,
+		"syncfs":    306,
+		"fallocate": 285,
+		"epoll_wait":  232,
+		"epoll_pwait": 281,
+		"futex":       202,
+		"nanosleep":   35,
+		"accept4":     288,
+		"recvmmsg":    299,
+		"sendmmsg":    307,
+	},
+	// arm64 uses the unified asm-generic/unistd.h table; it has no legacy
+	// open/stat/lstat/poll/access/pipe/select/dup2/fork/vfork/getdents/rename/
+	// mkdir/rmdir/creat/link/unlink/symlink/readlink/chmod/chown/epoll_wait
+	// syscalls at all, only their *at/*2/*64 replacements.
+	"arm64": {
+		"read":        63,
+		"write":       64,
+		"close":       57,
+		"fstat":       80,
+		"lseek":       62,
+		"mmap":        222,
+		"mprotect":    226,
+		"munmap":      215,
+		"brk":         214,
+		"pread64":     67,
+		"pwrite64":    68,
+		"readv":       65,
+		"writev":      66,
+		"dup":         23,
+		"socket":      198,
+		"connect":     203,
+		"accept":      202,
+		"sendto":      206,
+		"recvfrom":    207,
+		"sendmsg":     211,
+		"recvmsg":     212,
+		"shutdown":    210,
+		"bind":        200,
+		"listen":      201,
+		"clone":       220,
+		"execve":      221,
+		"exit":        93,
+		"wait4":       260,
+		"kill":        129,
+		"fcntl":       25,
+		"flock":       32,
+		"fsync":       82,
+		"fdatasync":   83,
+		"truncate":    45,
+		"ftruncate":   46,
+		"getcwd":      17,
+		"chdir":       49,
+		"fchmod":      52,
+		"fchown":      55,
+		"umask":       166,
+		"openat":      56,
+		"mkdirat":     34,
+		"fstatat":     79,
+		"unlinkat":    35,
+		"renameat":    38,
+		"faccessat":   48,
+		"splice":      76,
+		"sync":        81,
+		"syncfs":      267,
+		"fallocate":   47,
+		"epoll_pwait": 22,
+		"futex":       98,
+		"nanosleep":   101,
+		"accept4":     242,
+		"recvmmsg":    243,
+		"sendmmsg":    269,
+	},
+	// arm (32-bit EABI) syscall numbers.
+	"arm": {
+		"read":        3,
+		"write":       4,
+		"open":        5,
+		"close":       6,
+		"stat":        106,
+		"fstat":       108,
+		"lstat":       107,
+		"poll":        168,
+		"lseek":       19,
+		"mmap":        90,
+		"mprotect":    125,
+		"munmap":      91,
+		"brk":         45,
+		"pread64":     180,
+		"pwrite64":    181,
+		"readv":       145,
+		"writev":      146,
+		"access":      33,
+		"pipe":        42,
+		"select":      142,
+		"dup":         41,
+		"dup2":        63,
+		"socket":      281,
+		"connect":     283,
+		"accept":      285,
+		"sendto":      290,
+		"recvfrom":    292,
+		"sendmsg":     296,
+		"recvmsg":     297,
+		"shutdown":    293,
+		"bind":        282,
+		"listen":      284,
+		"clone":       120,
+		"fork":        2,
+		"vfork":       190,
+		"execve":      11,
+		"exit":        1,
+		"wait4":       114,
+		"kill":        37,
+		"fcntl":       55,
+		"flock":       143,
+		"fsync":       118,
+		"fdatasync":   148,
+		"truncate":    92,
+		"ftruncate":   93,
+		"getdents":    141,
+		"getcwd":      183,
+		"chdir":       12,
+		"rename":      38,
+		"mkdir":       39,
+		"rmdir":       40,
+		"creat":       8,
+		"link":        9,
+		"unlink":      10,
+		"symlink":     83,
+		"readlink":    85,
+		"chmod":       15,
+		"fchmod":      94,
+		"chown":       182,
+		"fchown":      95,
+		"lchown":      16,
+		"umask":       60,
+		"openat":      322,
+		"mkdirat":     323,
+		"fstatat":     327,
+		"unlinkat":    328,
+		"renameat":    329,
+		"faccessat":   334,
+		"splice":      340,
+		"sync":        36,
+		"syncfs":      373,
+		"fallocate":   352,
+		"epoll_wait":  252,
+		"epoll_pwait": 346,
+		"futex":       240,
+		"nanosleep":   162,
+		"accept4":     366,
+		"recvmmsg":    365,
+		"sendmmsg":    374,
+	},
+}
+
+// selectArchTable resolves the -arch flag to its syscall table, producing a
+// clear error (listing known archs) rather than silently falling back.
+func selectArchTable(arch string) (syscallTable, error) {
+	table, ok := syscallTables[arch]
+	if !ok {
+		var known []string
+		for a := range syscallTables {
+			known = append(known, a)
+		}
+		sort.Strings(known)
+		return nil, fmt.Errorf("unknown -arch %q (known: %s)", arch, strings.Join(known, ", "))
 	}
+	return table, nil
 }
 
+// syscallNums and syscallNames are the active arch's tables, selected in
+// main() via -arch/runtime.GOARCH before the -s list is parsed.
+var (
+	syscallNums  syscallTable
+	syscallNames = make(map[uint32]string)
+)
+
 func formatLatency(us int64) string {
 	if us < 1000 {
 		return fmt.Sprintf("%dµs", us)
@@ -307,8 +493,10 @@ func (s *State) Snapshot() (map[uint32]*syscallStats, time.Time, time.Time) {
 
 // Display handles rendering
 type Display struct {
-	batchMode   bool
-	processName string
+	batchMode      bool
+	processName    string
+	stacks         *stackCache   // nil unless -stack-threshold is set
+	stackThreshold time.Duration
 }
 
 func (d *Display) resetCursor() {
@@ -438,6 +626,10 @@ func (d *Display) render(stats map[uint32]*syscallStats, startTime, lastReset ti
 	buf.WriteString(strings.Repeat("=", lineWidth))
 	buf.WriteString("\n")
 
+	if d.stacks != nil {
+		d.writeSlowStacks(&buf, syscallList)
+	}
+
 	rate := float64(0)
 	if elapsed.Seconds() > 0 {
 		rate = float64(totalSamples) / elapsed.Seconds()
@@ -453,9 +645,501 @@ func (d *Display) render(stats map[uint32]*syscallStats, startTime, lastReset ti
 	fmt.Print(buf.String())
 }
 
+const slowStacksTopK = 3
+
+// writeSlowStacks appends a "SLOW STACKS" section listing, per syscall, the
+// top slowStacksTopK distinct kernel+user stacks (by occurrence count) that
+// crossed -stack-threshold - the code paths actually responsible for the
+// p99.9, rather than just its bare latency value.
+func (d *Display) writeSlowStacks(buf *strings.Builder, syscallList []uint32) {
+	fmt.Fprintf(buf, "SLOW STACKS (latency > %s)\n", d.stackThreshold)
+	buf.WriteString(strings.Repeat("-", lineWidth))
+	buf.WriteString("\n")
+
+	any := false
+	for _, id := range syscallList {
+		top := d.stacks.TopStacks(id, slowStacksTopK)
+		if len(top) == 0 {
+			continue
+		}
+		any = true
+		fmt.Fprintf(buf, "%s:\n", syscallDisplayName(id))
+		for _, s := range top {
+			fmt.Fprintf(buf, "  count=%-6d max=%s\n", s.count, formatLatency(s.maxLatencyUs))
+			for _, frame := range s.trace.kernel {
+				fmt.Fprintf(buf, "    [k] %s\n", frame)
+			}
+			for _, frame := range s.trace.user {
+				fmt.Fprintf(buf, "    [u] %s\n", frame)
+			}
+		}
+	}
+	if !any {
+		buf.WriteString("(none yet)\n")
+	}
+	buf.WriteString(strings.Repeat("=", lineWidth))
+	buf.WriteString("\n")
+}
+
+// classicBucketBoundariesUs are the upper bounds (µs) of the fixed, log-2 spaced
+// buckets used for the classic Prometheus histogram flavor, spanning histMin..histMax.
+var classicBucketBoundariesUs = func() []int64 {
+	var bounds []int64
+	for b := int64(histMin); b < histMax; b *= 2 {
+		bounds = append(bounds, b)
+	}
+	return append(bounds, histMax)
+}()
+
+// cumulativeBucketCounts folds an HDR histogram's own log-linear bars into
+// cumulative counts at each of the given µs boundaries (Prometheus classic
+// histograms are cumulative: bucket[i] counts every sample <= boundary[i]).
+func cumulativeBucketCounts(h *hdrhistogram.Histogram, boundariesUs []int64) []int64 {
+	counts := make([]int64, len(boundariesUs))
+	for _, bar := range h.Distribution() {
+		if bar.Count == 0 {
+			continue
+		}
+		for i, b := range boundariesUs {
+			if bar.To <= b {
+				counts[i] += bar.Count
+			}
+		}
+	}
+	return counts
+}
+
+// promCollector renders a State snapshot as Prometheus text exposition, in two
+// flavors: a classic fixed-bucket histogram for broad scraper compatibility, and
+// a second, finer series of buckets taken directly from HDR's own log-linear
+// layout so the p99.9 tail isn't flattened by the coarser power-of-2 boundaries.
+// True Prometheus native histograms are a protobuf-only wire format; this is the
+// closest equivalent reachable from hand-written text exposition. The snapshot is
+// taken through State's existing RWMutex (State.Snapshot), so scraping never
+// resets the interval histograms or otherwise disturbs the display goroutine.
+type promCollector struct {
+	state       *State
+	processName string
+}
+
+func (pc *promCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	stats, _, _ := pc.state.Snapshot()
+
+	var ids []uint32
+	for id := range stats {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return pc.syscallName(ids[i]) < pc.syscallName(ids[j]) })
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	fmt.Fprintln(w, "# HELP syscall_latency_seconds Per-syscall latency, lifetime histogram (classic fixed buckets).")
+	fmt.Fprintln(w, "# TYPE syscall_latency_seconds histogram")
+	for _, id := range ids {
+		pc.writeClassicHistogram(w, pc.syscallName(id), stats[id].lifetime)
+	}
+
+	fmt.Fprintln(w, "# HELP syscall_latency_hdr_bucket Per-syscall latency, lifetime histogram using HDR's own log-linear buckets (non-cumulative, sparse; preserves tail precision lost by the fixed buckets above).")
+	fmt.Fprintln(w, "# TYPE syscall_latency_hdr_bucket gauge")
+	for _, id := range ids {
+		pc.writeHdrBuckets(w, pc.syscallName(id), stats[id].lifetime)
+	}
+}
+
+func (pc *promCollector) syscallName(id uint32) string {
+	if name, ok := syscallNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("sys_%d", id)
+}
+
+func (pc *promCollector) labels(name string) string {
+	if pc.processName == "" {
+		return fmt.Sprintf(`syscall="%s"`, name)
+	}
+	return fmt.Sprintf(`syscall="%s",comm="%s"`, name, pc.processName)
+}
+
+func (pc *promCollector) writeClassicHistogram(w http.ResponseWriter, name string, h *hdrhistogram.Histogram) {
+	counts := cumulativeBucketCounts(h, classicBucketBoundariesUs)
+	var sum float64
+	for _, bar := range h.Distribution() {
+		sum += float64(bar.From+bar.To) / 2 / 1e6 * float64(bar.Count)
+	}
+	total := h.TotalCount()
+	labels := pc.labels(name)
+	for i, b := range classicBucketBoundariesUs {
+		fmt.Fprintf(w, "syscall_latency_seconds_bucket{%s,le=\"%.6f\"} %d\n", labels, float64(b)/1e6, counts[i])
+	}
+	fmt.Fprintf(w, "syscall_latency_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, total)
+	fmt.Fprintf(w, "syscall_latency_seconds_sum{%s} %f\n", labels, sum)
+	fmt.Fprintf(w, "syscall_latency_seconds_count{%s} %d\n", labels, total)
+}
+
+func (pc *promCollector) writeHdrBuckets(w http.ResponseWriter, name string, h *hdrhistogram.Histogram) {
+	labels := pc.labels(name)
+	for _, bar := range h.Distribution() {
+		if bar.Count == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "syscall_latency_hdr_bucket{%s,le=\"%.6f\"} %d\n", labels, float64(bar.To)/1e6, bar.Count)
+	}
+}
+
+// hdrV2CompressedCookie identifies a V2 compressed-encoding HdrHistogram
+// payload, matching the cookie HistogramLogAnalyzer/plotFiles expect.
+const hdrV2CompressedCookie = 0x1c849304
+
+// hdrV2EncodingCookie opens the uncompressed V2 payload inside that frame.
+const hdrV2EncodingCookie = 0x1c849303
+
+func zigZagEncode(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func putVarint(buf *bytes.Buffer, v uint64) {
+	for v >= 0x80 {
+		buf.WriteByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	buf.WriteByte(byte(v))
+}
+
+// encodeCountsV2 zig-zag/varint encodes the counts array, run-length
+// compressing zero runs, matching HdrHistogram's V2 counts-array encoding.
+func encodeCountsV2(counts []int64) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < len(counts); {
+		c := counts[i]
+		if c == 0 {
+			run := int64(1)
+			i++
+			for i < len(counts) && counts[i] == 0 {
+				run++
+				i++
+			}
+			if run > 1 {
+				putVarint(&buf, zigZagEncode(-run))
+				continue
+			}
+			putVarint(&buf, zigZagEncode(0))
+			continue
+		}
+		putVarint(&buf, zigZagEncode(c))
+		i++
+	}
+	return buf.Bytes()
+}
+
+// encodeHistogramV2Compressed serializes h as a V2 compressed HdrHistogram
+// payload: header fields big-endian, counts array zig-zag/varint encoded,
+// the whole thing zlib-compressed and prefixed with the V2 compressed cookie
+// and payload length, same framing HistogramLogAnalyzer/plotFiles expect.
+func encodeHistogramV2Compressed(h *hdrhistogram.Histogram) []byte {
+	snap := h.Export()
+	counts := encodeCountsV2(snap.Counts)
+
+	var inner bytes.Buffer
+	binary.Write(&inner, binary.BigEndian, int32(hdrV2EncodingCookie))
+	binary.Write(&inner, binary.BigEndian, int32(len(counts))) // payload length
+	binary.Write(&inner, binary.BigEndian, int32(0))           // normalizingIndexOffset
+	binary.Write(&inner, binary.BigEndian, int32(snap.SignificantFigures))
+	binary.Write(&inner, binary.BigEndian, snap.LowestTrackableValue)
+	binary.Write(&inner, binary.BigEndian, snap.HighestTrackableValue)
+	binary.Write(&inner, binary.BigEndian, math.Float64bits(1.0)) // integerToDoubleValueConversionRatio
+	inner.Write(counts)
+
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(inner.Bytes())
+	zw.Close()
+
+	var out bytes.Buffer
+	binary.Write(&out, binary.BigEndian, int32(hdrV2CompressedCookie))
+	binary.Write(&out, binary.BigEndian, int32(compressed.Len()))
+	out.Write(compressed.Bytes())
+	return out.Bytes()
+}
+
+// hdrLogWriter writes per-syscall histograms in the standard HdrHistogram
+// interval-log text format: one "Tag=<syscall>" line per syscall per
+// interval, base/start timestamps relative to the log's StartTime, and a
+// base64-encoded compressed histogram payload. This lets runs be
+// post-processed with HistogramLogAnalyzer/plotFiles at full resolution,
+// instead of the truncated p50/p90/p99/p99.9/max columns the TTY shows.
+type hdrLogWriter struct {
+	f    *os.File
+	base time.Time
+}
+
+func newHdrLogWriter(path string, base time.Time) (*hdrLogWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &hdrLogWriter{f: f, base: base}
+	fmt.Fprintf(f, "#[Logged with syscall-latency]\n")
+	fmt.Fprintf(f, "#[StartTime: %.3f (seconds since epoch)]\n", float64(base.UnixNano())/1e9)
+	fmt.Fprintln(f, `"StartTimestamp","Interval_Length","Interval_Max","Interval_Compressed_Histogram"`)
+	return w, nil
+}
+
+func (w *hdrLogWriter) WriteInterval(tag string, start, end time.Time, h *hdrhistogram.Histogram) error {
+	encoded := base64.StdEncoding.EncodeToString(encodeHistogramV2Compressed(h))
+	_, err := fmt.Fprintf(w.f, "Tag=%s,%.3f,%.3f,%d,%s\n",
+		tag, start.Sub(w.base).Seconds(), end.Sub(start).Seconds(), h.Max(), encoded)
+	return err
+}
+
+func (w *hdrLogWriter) Close() error {
+	return w.f.Close()
+}
+
+// writeHdrLogInterval snapshots State (non-destructively, via State.Snapshot)
+// and appends one interval-histogram entry per syscall that saw traffic.
+func writeHdrLogInterval(w *hdrLogWriter, state *State) {
+	stats, _, lastReset := state.Snapshot()
+	now := time.Now()
+
+	var ids []uint32
+	for id := range stats {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return syscallDisplayName(ids[i]) < syscallDisplayName(ids[j]) })
+
+	for _, id := range ids {
+		ss := stats[id]
+		if ss.interval.TotalCount() == 0 {
+			continue
+		}
+		name := syscallDisplayName(id)
+		if err := w.WriteInterval(name, lastReset, now, ss.interval); err != nil {
+			log.Printf("hdrlog: failed to write interval for %s: %v", name, err)
+		}
+	}
+}
+
+func syscallDisplayName(id uint32) string {
+	if name, ok := syscallNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("sys_%d", id)
+}
+
+// maxStackDepth matches the depth bpf2go generates for the BPF_MAP_TYPE_STACK_TRACE
+// entries in bpf/syscall_latency.c (PERF_MAX_STACK_DEPTH-sized uint64 arrays).
+const maxStackDepth = 127
+
+type kallsymEntry struct {
+	addr uint64
+	name string
+}
+
+// loadKallsyms reads /proc/kallsyms once and returns entries sorted by
+// address, so kernel stack addresses can be resolved to the nearest
+// preceding symbol via binary search.
+func loadKallsyms() []kallsymEntry {
+	f, err := os.Open("/proc/kallsyms")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var entries []kallsymEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		addr, err := strconv.ParseUint(fields[0], 16, 64)
+		if err != nil || addr == 0 {
+			continue
+		}
+		entries = append(entries, kallsymEntry{addr: addr, name: fields[2]})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].addr < entries[j].addr })
+	return entries
+}
+
+func resolveKernelAddr(kallsym []kallsymEntry, addr uint64) string {
+	i := sort.Search(len(kallsym), func(i int) bool { return kallsym[i].addr > addr }) - 1
+	if i < 0 {
+		return fmt.Sprintf("0x%x", addr)
+	}
+	return kallsym[i].name
+}
+
+type procMapEntry struct {
+	start, end, offset uint64
+	path               string
+}
+
+// loadProcMaps parses /proc/<pid>/maps for user-stack resolution. It's read
+// fresh per stack (rather than cached across the process lifetime) since
+// shared libraries can be mapped/unmapped as the traced process runs.
+func loadProcMaps(pid uint32) []procMapEntry {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/maps", pid))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var entries []procMapEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		bounds := strings.SplitN(fields[0], "-", 2)
+		if len(bounds) != 2 {
+			continue
+		}
+		start, errStart := strconv.ParseUint(bounds[0], 16, 64)
+		end, errEnd := strconv.ParseUint(bounds[1], 16, 64)
+		offset, errOff := strconv.ParseUint(fields[2], 16, 64)
+		if errStart != nil || errEnd != nil || errOff != nil {
+			continue
+		}
+		entries = append(entries, procMapEntry{start: start, end: end, offset: offset, path: fields[5]})
+	}
+	return entries
+}
+
+// resolveUserAddr renders addr as "<mapped file>+<offset>", the same
+// poor-man's symbolization `perf script` falls back to without a DWARF/symtab
+// parser: good enough to tell which library or binary is responsible.
+func resolveUserAddr(maps []procMapEntry, addr uint64) string {
+	for _, m := range maps {
+		if addr >= m.start && addr < m.end {
+			return fmt.Sprintf("%s+0x%x", filepath.Base(m.path), addr-m.start+m.offset)
+		}
+	}
+	return fmt.Sprintf("0x%x", addr)
+}
+
+// stackTrace is one symbolized kernel+user stack.
+type stackTrace struct {
+	kernel []string
+	user   []string
+}
+
+// slowStackStats aggregates occurrence count and max latency for one
+// distinct (kstack_id, ustack_id) pair seen for a given syscall.
+type slowStackStats struct {
+	trace        stackTrace
+	count        int64
+	maxLatencyUs int64
+}
+
+// stackCache resolves BPF stack-trace ids via objs.StackTraces.Lookup and
+// symbolizes them on first sight (kallsyms for the kernel half, /proc/<pid>/maps
+// for the user half), then aggregates identical stacks per syscall so slow
+// outliers collapse into the handful of code paths actually responsible,
+// rather than a wall of one-off samples.
+type stackCache struct {
+	mu         sync.Mutex
+	objs       *bpfObjects
+	kallsym    []kallsymEntry
+	resolved   map[[2]int32]stackTrace
+	perSyscall map[uint32]map[[2]int32]*slowStackStats
+}
+
+func newStackCache(objs *bpfObjects) *stackCache {
+	return &stackCache{
+		objs:       objs,
+		kallsym:    loadKallsyms(),
+		resolved:   make(map[[2]int32]stackTrace),
+		perSyscall: make(map[uint32]map[[2]int32]*slowStackStats),
+	}
+}
+
+func (sc *stackCache) Record(syscallID, pid uint32, kstackID, ustackID int32, latencyUs int64) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	key := [2]int32{kstackID, ustackID}
+	trace, ok := sc.resolved[key]
+	if !ok {
+		trace = sc.symbolize(pid, kstackID, ustackID)
+		sc.resolved[key] = trace
+	}
+
+	bySyscall, ok := sc.perSyscall[syscallID]
+	if !ok {
+		bySyscall = make(map[[2]int32]*slowStackStats)
+		sc.perSyscall[syscallID] = bySyscall
+	}
+	stats, ok := bySyscall[key]
+	if !ok {
+		stats = &slowStackStats{trace: trace}
+		bySyscall[key] = stats
+	}
+	stats.count++
+	if latencyUs > stats.maxLatencyUs {
+		stats.maxLatencyUs = latencyUs
+	}
+}
+
+func (sc *stackCache) symbolize(pid uint32, kstackID, ustackID int32) stackTrace {
+	var trace stackTrace
+	if kstackID >= 0 {
+		var addrs [maxStackDepth]uint64
+		if err := sc.objs.StackTraces.Lookup(uint32(kstackID), &addrs); err == nil {
+			for _, a := range addrs {
+				if a == 0 {
+					break
+				}
+				trace.kernel = append(trace.kernel, resolveKernelAddr(sc.kallsym, a))
+			}
+		}
+	}
+	if ustackID >= 0 {
+		var addrs [maxStackDepth]uint64
+		if err := sc.objs.StackTraces.Lookup(uint32(ustackID), &addrs); err == nil {
+			maps := loadProcMaps(pid)
+			for _, a := range addrs {
+				if a == 0 {
+					break
+				}
+				trace.user = append(trace.user, resolveUserAddr(maps, a))
+			}
+		}
+	}
+	return trace
+}
+
+// TopStacks returns up to k stacks recorded for syscallID, sorted by
+// occurrence count descending.
+func (sc *stackCache) TopStacks(syscallID uint32, k int) []*slowStackStats {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	bySyscall := sc.perSyscall[syscallID]
+	stats := make([]*slowStackStats, 0, len(bySyscall))
+	for _, s := range bySyscall {
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].count > stats[j].count })
+	if len(stats) > k {
+		stats = stats[:k]
+	}
+	return stats
+}
+
 func main() {
 	flag.Parse()
 
+	table, err := selectArchTable(*archFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	syscallNums = table
+	for name, num := range syscallNums {
+		syscallNames[num] = name
+	}
+
 	// Parse syscall list
 	var traceSyscalls []uint32
 	for _, name := range strings.Split(*syscallList, ",") {
@@ -466,6 +1150,20 @@ func main() {
 		if num, ok := syscallNums[name]; ok {
 			traceSyscalls = append(traceSyscalls, num)
 		} else {
+			var otherArchs []string
+			for arch, t := range syscallTables {
+				if arch == *archFlag {
+					continue
+				}
+				if _, ok := t[name]; ok {
+					otherArchs = append(otherArchs, arch)
+				}
+			}
+			if len(otherArchs) > 0 {
+				sort.Strings(otherArchs)
+				log.Fatalf("Unknown syscall %q for -arch %s (exists on: %s) - pick a name valid for %s or switch -arch",
+					name, *archFlag, strings.Join(otherArchs, ", "), *archFlag)
+			}
 			log.Fatalf("Unknown syscall: %s", name)
 		}
 	}
@@ -486,7 +1184,10 @@ func main() {
 	}
 	defer objs.Close()
 
-	// Set up syscall filter
+	// Set up syscall filter. objs.SyscallFilter is keyed by raw syscall number,
+	// which differs per architecture; traceSyscalls was already resolved
+	// against the table for *archFlag above, so the filter stays correct
+	// regardless of which arch's binary is tracing.
 	for _, num := range traceSyscalls {
 		var enabled uint8 = 1
 		if err := objs.SyscallFilter.Put(num, enabled); err != nil {
@@ -505,6 +1206,20 @@ func main() {
 		log.Printf("Filtering by process: %s", *processName)
 	}
 
+	// Push the stack-capture threshold into BPF: above this, trace_syscall_exit
+	// walks bpf_get_stackid() for both kernel and user stacks into StackTraces
+	// and fills in the event's kstack_id/ustack_id.
+	var stacks *stackCache
+	if *stackThreshold > 0 {
+		var key uint32 = 0
+		thresholdNs := uint64(stackThreshold.Nanoseconds())
+		if err := objs.StackThreshold.Put(key, thresholdNs); err != nil {
+			log.Fatalf("Failed to set stack threshold: %v", err)
+		}
+		stacks = newStackCache(&objs)
+		log.Printf("Capturing stacks for syscalls slower than %s", *stackThreshold)
+	}
+
 	// Attach tracepoints
 	tpEnter, err := link.Tracepoint("raw_syscalls", "sys_enter", objs.TraceSyscallEnter, nil)
 	if err != nil {
@@ -526,7 +1241,34 @@ func main() {
 	defer rd.Close()
 
 	state := newState()
-	display := &Display{batchMode: *batch, processName: *processName}
+	display := &Display{batchMode: *batch, processName: *processName, stacks: stacks, stackThreshold: *stackThreshold}
+
+	var hdrLog *hdrLogWriter
+	if *hdrLogPath != "" {
+		hdrLog, err = newHdrLogWriter(*hdrLogPath, time.Now())
+		if err != nil {
+			log.Fatalf("Failed to open -hdrlog file: %v", err)
+		}
+		defer hdrLog.Close()
+	}
+
+	// Prometheus /metrics endpoint (non-destructive: snapshots State under its
+	// existing RWMutex, same as the display goroutine, so it can coexist with
+	// the interval reset loop without disturbing either).
+	if *prometheusEnabled || *listenAddr != "" {
+		addr := *listenAddr
+		if addr == "" {
+			addr = defaultMetricsAddr
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", &promCollector{state: state, processName: *processName})
+		go func() {
+			log.Printf("Serving Prometheus metrics on %s/metrics", addr)
+			if err := http.ListenAndServe(addr, mux); err != nil {
+				log.Printf("Prometheus metrics server stopped: %v", err)
+			}
+		}()
+	}
 
 	// Signal handling
 	done := make(chan struct{})
@@ -564,6 +1306,9 @@ func main() {
 			case <-done:
 				return
 			case <-intervalTicker.C:
+				if hdrLog != nil {
+					writeHdrLogInterval(hdrLog, state)
+				}
 				state.ResetIntervals()
 			}
 		}
@@ -580,6 +1325,9 @@ func main() {
 	for {
 		select {
 		case <-done:
+			if hdrLog != nil {
+				writeHdrLogInterval(hdrLog, state)
+			}
 			stats, startTime, lastReset := state.Snapshot()
 			display.render(stats, startTime, lastReset, *interval)
 			return
@@ -607,5 +1355,8 @@ func main() {
 		}
 
 		state.Record(event.SyscallId, latencyUs)
+		if stacks != nil && event.LatencyNs >= uint64(*stackThreshold) {
+			stacks.Record(event.SyscallId, event.Pid, event.KstackId, event.UstackId, latencyUs)
+		}
 	}
 }
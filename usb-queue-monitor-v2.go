@@ -4,8 +4,12 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"math"
+	"net/http"
 	"os"
+	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -16,39 +20,209 @@ import (
 )
 
 const (
-	displayInterval = 50 * time.Millisecond // ~20 FPS display refresh
-	reservoirSize   = 10000
-	maxQueuePerDev  = 30
-	usbDeviceCount  = 5
-	maxQueueUSBAggr = maxQueuePerDev * usbDeviceCount // 150 total
-	sampleBatchSize = 1000                            // samples before acquiring lock
+	displayInterval      = 50 * time.Millisecond // ~20 FPS display refresh
+	reservoirSize        = 10000
+	maxQueuePerDev       = 30
+	sampleBatchSize      = 1000            // samples before acquiring lock
+	deviceRescanInterval = 5 * time.Second // /sys/block rescan period for hotplug discovery
+	statSampleInterval   = 1 * time.Second // /sys/block/<dev>/stat delta window for rate metrics
+
+	// ReservoirSampler only stores ints; MB/s and service-time metrics are
+	// stored pre-multiplied by these factors to keep sub-unit precision and
+	// unscaled again at display time.
+	mbpsScale  = 100
+	svcMsScale = 100
 )
 
-// Device indices for slice-based access (eliminates map overhead in hot path)
-const (
-	devSda = iota
-	devNvme0n1
-	devNvme1n1
-	devSep1 // separator (empty line in display)
-	devSdc
-	devSdd
-	devSde
-	devSdf
-	devSdg
-	numDeviceSlots
-)
+// Configurable percentiles to display (P0 replaced by Util column)
+var percentiles = []float64{10, 20, 30, 40, 50, 60, 70, 80, 90, 95, 99, 99.5, 99.9, 99.95, 99.99, 99.995, 99.999, 100}
+
+// quantileConfig selects which quantile-estimation engine freshly-constructed
+// *ReservoirSampler instances use. It is set once in main(), from the
+// -quantiles flag, before the first sampler is built, and never changes
+// afterwards - so no lock is needed to read it from NewReservoirSampler.
+var quantileConfig = struct {
+	tdigest bool
+	delta   float64
+}{delta: 100}
+
+// tdigestCentroid is one weighted mean in a TDigest's sorted centroid list.
+type tdigestCentroid struct {
+	mean   float64
+	weight float64
+}
+
+// TDigest is a Dunning t-digest: a small, sorted set of weighted centroids
+// that cluster densely near q=0 and q=1 and sparsely in the middle, giving
+// roughly uniform relative accuracy across quantiles - including the deep
+// tails a fixed-size uniform reservoir represents poorly once the true
+// sample count far exceeds the reservoir size. See Dunning & Ertl,
+// "Computing Extremely Accurate Quantiles Using t-Digests".
+type TDigest struct {
+	centroids  []tdigestCentroid // kept sorted by mean
+	delta      float64           // compression parameter (bigger = more accurate, more memory)
+	count      float64           // total weight absorbed
+	compressAt int               // recompress once len(centroids) exceeds this
+}
 
-// Device names indexed by device constants above
-var deviceNames = [numDeviceSlots]string{"sda", "nvme0n1", "nvme1n1", "", "sdc", "sdd", "sde", "sdf", "sdg"}
+// NewTDigest creates an empty digest with the given compression parameter.
+func NewTDigest(delta float64) *TDigest {
+	compressAt := int(10 * delta)
+	if compressAt < 20 {
+		compressAt = 20
+	}
+	return &TDigest{delta: delta, compressAt: compressAt}
+}
 
-// USB device indices for aggregate calculation
-var usbDeviceIndices = [usbDeviceCount]int{devSdc, devSdd, devSde, devSdf, devSdg}
+// k is the t-digest scale function: a centroid sitting at cumulative
+// quantile q may grow to at most 4*count*q*(1-q)/delta before it must split,
+// so a bigger delta keeps more, smaller centroids.
+func (d *TDigest) k(q float64) float64 {
+	return 4 * d.count * q * (1 - q) / d.delta
+}
 
+// Add absorbs one sample with weight 1.
+func (d *TDigest) Add(x float64) {
+	d.addWeighted(x, 1)
+}
 
-// Configurable percentiles to display (P0 replaced by Util column)
-var percentiles = []float64{10, 20, 30, 40, 50, 60, 70, 80, 90, 95, 99, 99.5, 99.9, 99.95, 99.99, 99.995, 99.999, 100}
+// addWeighted merges a weighted point into the nearest centroid whose scale
+// bound still allows it, or inserts a new singleton centroid in sorted
+// position otherwise. Used directly by Add, and by Merge to fold in another
+// digest's (already weighted) centroids.
+func (d *TDigest) addWeighted(x, w float64) {
+	if len(d.centroids) == 0 {
+		d.centroids = append(d.centroids, tdigestCentroid{mean: x, weight: w})
+		d.count = w
+		return
+	}
+
+	idx := sort.Search(len(d.centroids), func(i int) bool { return d.centroids[i].mean >= x })
+	best := idx
+	if best == len(d.centroids) {
+		best--
+	}
+	if idx > 0 && math.Abs(d.centroids[idx-1].mean-x) < math.Abs(d.centroids[best].mean-x) {
+		best = idx - 1
+	}
+
+	cumBefore := 0.0
+	for i := 0; i < best; i++ {
+		cumBefore += d.centroids[i].weight
+	}
+	q := (cumBefore + d.centroids[best].weight/2) / (d.count + w)
+	bound := d.k(q)
+
+	newWeight := d.centroids[best].weight + w
+	if bound <= 0 || newWeight <= bound {
+		c := &d.centroids[best]
+		c.mean += (x - c.mean) * (w / newWeight)
+		c.weight = newWeight
+	} else {
+		d.centroids = append(d.centroids, tdigestCentroid{})
+		copy(d.centroids[idx+1:], d.centroids[idx:])
+		d.centroids[idx] = tdigestCentroid{mean: x, weight: w}
+	}
+	d.count += w
+
+	if len(d.centroids) > d.compressAt {
+		d.compress()
+	}
+}
+
+// compress performs a single left-to-right greedy merge pass, collapsing
+// adjacent centroids back down to a set honoring the same k(q) bound - the
+// standard t-digest compaction step, run whenever centroids accumulate past
+// compressAt.
+func (d *TDigest) compress() {
+	if len(d.centroids) == 0 {
+		return
+	}
+	sort.Slice(d.centroids, func(i, j int) bool { return d.centroids[i].mean < d.centroids[j].mean })
+
+	merged := make([]tdigestCentroid, 0, len(d.centroids))
+	cur := d.centroids[0]
+	cum := 0.0
+	for i := 1; i < len(d.centroids); i++ {
+		next := d.centroids[i]
+		newWeight := cur.weight + next.weight
+		q := (cum + newWeight/2) / d.count
+		bound := d.k(q)
+		if bound <= 0 || newWeight <= bound {
+			cur.mean += (next.mean - cur.mean) * (next.weight / newWeight)
+			cur.weight = newWeight
+		} else {
+			cum += cur.weight
+			merged = append(merged, cur)
+			cur = next
+		}
+	}
+	d.centroids = append(merged, cur)
+}
+
+// Quantile returns the interpolated value at cumulative fraction q in [0,1],
+// linearly interpolating between the midpoints of the two centroids
+// straddling q's target cumulative weight.
+func (d *TDigest) Quantile(q float64) float64 {
+	n := len(d.centroids)
+	if n == 0 {
+		return 0
+	}
+	if n == 1 || q <= 0 {
+		return d.centroids[0].mean
+	}
+	if q >= 1 {
+		return d.centroids[n-1].mean
+	}
+
+	target := q * d.count
+	cum := 0.0
+	for i := 0; i < n; i++ {
+		c := d.centroids[i]
+		midCum := cum + c.weight/2
+		if target < midCum {
+			if i == 0 {
+				return c.mean
+			}
+			prev := d.centroids[i-1]
+			prevMidCum := cum - prev.weight/2
+			frac := (target - prevMidCum) / (midCum - prevMidCum)
+			return prev.mean + frac*(c.mean-prev.mean)
+		}
+		cum += c.weight
+	}
+	return d.centroids[n-1].mean
+}
 
-// ReservoirSampler maintains a fixed-size representative sample using reservoir sampling
+// Count returns the total weight (sample count) absorbed so far.
+func (d *TDigest) Count() float64 {
+	return d.count
+}
+
+// Merge absorbs all of other's centroids, weight and all, as if each had
+// been fed through addWeighted individually - used to fold a small local
+// digest (built lock-free in a batchAccum) into the shared one under a
+// single, short lock acquisition.
+func (d *TDigest) Merge(other *TDigest) {
+	for _, c := range other.centroids {
+		d.addWeighted(c.mean, c.weight)
+	}
+}
+
+// clone returns an independent copy, for snapshotting a live digest under
+// lock so the caller can query it (e.g. Quantile) after unlocking.
+func (d *TDigest) clone() *TDigest {
+	cp := &TDigest{delta: d.delta, count: d.count, compressAt: d.compressAt}
+	cp.centroids = make([]tdigestCentroid, len(d.centroids))
+	copy(cp.centroids, d.centroids)
+	return cp
+}
+
+// ReservoirSampler maintains a fixed-size representative sample using
+// reservoir sampling, or - when quantileConfig.tdigest is set at
+// construction time - a t-digest instead. Either way the running sum,
+// nonZero count, max and count scalars behave identically, so GetAverage,
+// GetUtilization and GetMax are engine-agnostic.
 type ReservoirSampler struct {
 	reservoir []int
 	count     uint64
@@ -56,12 +230,15 @@ type ReservoirSampler struct {
 	nonZero   uint64 // count of samples where value > 0
 	max       int    // true maximum ever seen (never decreases)
 	size      int
-	rngState  uint64 // xorshift64 state (faster than rand.Rand)
+	rngState  uint64   // xorshift64 state (faster than rand.Rand)
+	digest    *TDigest // non-nil when this sampler estimates quantiles via t-digest
 }
 
-// NewReservoirSampler creates a new reservoir sampler
+// NewReservoirSampler creates a new reservoir sampler. If quantileConfig
+// selects t-digest mode, size instead becomes the warmup-sample threshold
+// IsFull waits for (see IsFull).
 func NewReservoirSampler(size int) *ReservoirSampler {
-	return &ReservoirSampler{
+	rs := &ReservoirSampler{
 		reservoir: make([]int, 0, size),
 		count:     0,
 		sum:       0,
@@ -69,9 +246,15 @@ func NewReservoirSampler(size int) *ReservoirSampler {
 		size:      size,
 		rngState:  uint64(time.Now().UnixNano()) | 1, // ensure non-zero
 	}
+	if quantileConfig.tdigest {
+		rs.digest = NewTDigest(quantileConfig.delta)
+	}
+	return rs
 }
 
-// Add adds a value to the reservoir (used during warmup phase)
+// Add adds a value, updating the reservoir or the t-digest depending on
+// which engine this sampler was constructed with (used during warmup phase
+// in reservoir mode; called directly for every sample in t-digest mode)
 func (rs *ReservoirSampler) Add(value int) {
 	rs.count++
 	rs.sum += uint64(value)
@@ -81,6 +264,10 @@ func (rs *ReservoirSampler) Add(value int) {
 	if value > rs.max {
 		rs.max = value
 	}
+	if rs.digest != nil {
+		rs.digest.Add(float64(value))
+		return
+	}
 	if len(rs.reservoir) < rs.size {
 		rs.reservoir = append(rs.reservoir, value)
 	} else {
@@ -96,32 +283,81 @@ func (rs *ReservoirSampler) Add(value int) {
 	}
 }
 
-// ApplyBatch applies pre-computed batch statistics in minimal time under lock
-// reservoirUpdates contains only the slots that need updating (last-writer-wins)
-func (rs *ReservoirSampler) ApplyBatch(count, sum, nonZero uint64, max int, reservoirUpdates map[int]int) {
+// ApplyBatch applies pre-computed batch statistics in minimal time under
+// lock. In reservoir mode, reservoirUpdates contains only the slots that
+// need updating (last-writer-wins) and localDigest is nil; in t-digest mode
+// localDigest is merged into rs.digest instead and reservoirUpdates is nil.
+func (rs *ReservoirSampler) ApplyBatch(count, sum, nonZero uint64, max int, reservoirUpdates map[int]int, localDigest *TDigest) {
 	rs.count += count
 	rs.sum += sum
 	rs.nonZero += nonZero
 	if max > rs.max {
 		rs.max = max
 	}
+	if rs.digest != nil {
+		rs.digest.Merge(localDigest)
+		return
+	}
 	for slot, value := range reservoirUpdates {
 		rs.reservoir[slot] = value
 	}
 }
 
-// IsFull returns true if reservoir has reached capacity
+// IsFull returns true once warmup has absorbed size samples: reservoir
+// capacity in reservoir mode, or digest weight in t-digest mode (size still
+// marks the point the sampler goroutine switches from Add-per-sample to
+// batched ApplyBatch calls).
 func (rs *ReservoirSampler) IsFull() bool {
+	if rs.digest != nil {
+		return rs.digest.Count() >= float64(rs.size)
+	}
 	return len(rs.reservoir) >= rs.size
 }
 
-// GetSamples returns a copy of the reservoir
+// GetSamples returns a copy of the reservoir. In t-digest mode there is no
+// reservoir, so this returns an empty slice; use Percentiles for quantiles
+// instead of calcPercentiles(GetSamples()) so callers work in either mode.
 func (rs *ReservoirSampler) GetSamples() []int {
 	samples := make([]int, len(rs.reservoir))
 	copy(samples, rs.reservoir)
 	return samples
 }
 
+// Percentiles returns an estimate of each entry in the package-level
+// percentiles slice, backed by whichever quantile engine this sampler was
+// constructed with: the reservoir (sorted fresh on each call) or, in
+// t-digest mode, direct centroid interpolation.
+func (rs *ReservoirSampler) Percentiles() []float64 {
+	if rs.digest != nil {
+		results := make([]float64, len(percentiles))
+		for i, pct := range percentiles {
+			results[i] = rs.digest.Quantile(pct / 100.0)
+		}
+		return results
+	}
+	return calcPercentiles(rs.GetSamples())
+}
+
+// Snapshot copies rs's scalar fields and, in t-digest mode, a clone of its
+// digest, into a new independent *ReservoirSampler safe to use after the
+// caller's lock is released. In reservoir mode the raw reservoir slice is
+// deliberately left for the caller to copy separately via GetSamples() after
+// unlocking - it's the expensive part, and the whole point of snapshotting
+// scalars first is to keep that copy outside the lock.
+func (rs *ReservoirSampler) Snapshot() *ReservoirSampler {
+	cp := &ReservoirSampler{
+		count:   rs.count,
+		sum:     rs.sum,
+		nonZero: rs.nonZero,
+		max:     rs.max,
+		size:    rs.size,
+	}
+	if rs.digest != nil {
+		cp.digest = rs.digest.clone()
+	}
+	return cp
+}
+
 // GetCount returns the total number of samples seen
 func (rs *ReservoirSampler) GetCount() uint64 {
 	return rs.count
@@ -228,6 +464,88 @@ func (ir *InflightReader) Close() error {
 	return ir.file.Close()
 }
 
+// blockStat is the subset of /sys/block/<dev>/stat (see Documentation/
+// admin-guide/iostats.rst) this tool derives rate metrics from: completed
+// reads/writes, their sector counts, and cumulative I/O busy time.
+type blockStat struct {
+	readsCompleted  uint64
+	sectorsRead     uint64
+	msReading       uint64
+	writesCompleted uint64
+	sectorsWritten  uint64
+	msWriting       uint64
+	msDoingIO       uint64 // field 10: time spent doing I/Os (ms)
+}
+
+// StatReader holds an open file handle for fast repeated /sys/block/<dev>/stat
+// reads, mirroring InflightReader.
+type StatReader struct {
+	file *os.File
+	buf  []byte
+}
+
+// NewStatReader opens a persistent file handle for the device's stat file
+func NewStatReader(device string) (*StatReader, error) {
+	path := fmt.Sprintf("/sys/block/%s/stat", device)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &StatReader{
+		file: f,
+		buf:  make([]byte, 512), // stat line is short but has 11-17 fields
+	}, nil
+}
+
+// Read uses pread to read from offset 0 in a single syscall, then parses the
+// whitespace-separated counters with the same hand-rolled ASCII→int loop as
+// InflightReader.Read (no strings.Fields/strconv allocations).
+func (sr *StatReader) Read() (blockStat, error) {
+	n, err := syscall.Pread(int(sr.file.Fd()), sr.buf, 0)
+	if err != nil {
+		return blockStat{}, err
+	}
+
+	var fields [11]uint64
+	i, field := 0, 0
+	for i < n && field < len(fields) {
+		for i < n && (sr.buf[i] == ' ' || sr.buf[i] == '\t') {
+			i++
+		}
+		v := uint64(0)
+		for i < n && sr.buf[i] >= '0' && sr.buf[i] <= '9' {
+			v = v*10 + uint64(sr.buf[i]-'0')
+			i++
+		}
+		fields[field] = v
+		field++
+	}
+
+	return blockStat{
+		readsCompleted:  fields[0],
+		sectorsRead:     fields[2],
+		msReading:       fields[3],
+		writesCompleted: fields[4],
+		sectorsWritten:  fields[6],
+		msWriting:       fields[7],
+		msDoingIO:       fields[9],
+	}, nil
+}
+
+// Close closes the file handle
+func (sr *StatReader) Close() error {
+	return sr.file.Close()
+}
+
+// diffUint64 returns cur-prev, or 0 if the counter went backwards (e.g. a
+// device was replaced and /sys/block/<dev>/stat restarted from zero).
+func diffUint64(cur, prev uint64) uint64 {
+	if cur < prev {
+		return 0
+	}
+	return cur - prev
+}
+
 // getInflight reads the current in-flight IO count for a device (legacy, used at startup)
 func getInflight(device string) (int, error) {
 	data, err := os.ReadFile(fmt.Sprintf("/sys/block/%s/inflight", device))
@@ -340,17 +658,625 @@ func formatCount(count uint64) string {
 	return fmt.Sprintf("%d", count)
 }
 
+// metricKind selects which per-device metric drives Display.render's
+// bar/percentile columns. Queue depth (the original behavior) stays default.
+type metricKind int
+
+const (
+	metricQueueDepth metricKind = iota
+	metricReadIOPS
+	metricWriteIOPS
+	metricReadMBps
+	metricWriteMBps
+	metricServiceMs
+)
+
+// parseMetricFlag maps the -metric flag value to a metricKind.
+func parseMetricFlag(s string) (metricKind, error) {
+	switch s {
+	case "queue", "":
+		return metricQueueDepth, nil
+	case "r-iops":
+		return metricReadIOPS, nil
+	case "w-iops":
+		return metricWriteIOPS, nil
+	case "r-mbps":
+		return metricReadMBps, nil
+	case "w-mbps":
+		return metricWriteMBps, nil
+	case "svc-ms":
+		return metricServiceMs, nil
+	default:
+		return 0, fmt.Errorf("unknown metric %q (want one of: queue, r-iops, w-iops, r-mbps, w-mbps, svc-ms)", s)
+	}
+}
+
+// metricLabel returns the column label shown in the title for the metric.
+func metricLabel(m metricKind) string {
+	switch m {
+	case metricReadIOPS:
+		return "r-iops"
+	case metricWriteIOPS:
+		return "w-iops"
+	case metricReadMBps:
+		return "r-mbps"
+	case metricWriteMBps:
+		return "w-mbps"
+	case metricServiceMs:
+		return "svc-ms"
+	default:
+		return "queue"
+	}
+}
+
+// metricScale returns the factor a metric's reservoir values are
+// pre-multiplied by, so display can divide it back out.
+func metricScale(m metricKind) float64 {
+	switch m {
+	case metricReadMBps, metricWriteMBps:
+		return mbpsScale
+	case metricServiceMs:
+		return svcMsScale
+	default:
+		return 1
+	}
+}
+
+// deviceKind classifies a /sys/block entry by where it attaches in the
+// kernel device tree.
+type deviceKind int
+
+const (
+	kindUnknown deviceKind = iota
+	kindNVMe
+	kindSATA
+	kindUSB
+)
+
+// discoverDevices enumerates /sys/block, filtering out pseudo-devices
+// (loopback, device-mapper, optical, ramdisk, ZFS zvol) that are never real
+// storage we want to sample.
+func discoverDevices() []string {
+	entries, err := os.ReadDir("/sys/block")
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		switch {
+		case strings.HasPrefix(name, "loop"),
+			strings.HasPrefix(name, "dm-"),
+			strings.HasPrefix(name, "sr"),
+			strings.HasPrefix(name, "ram"),
+			strings.HasPrefix(name, "zd"):
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// classifyDevice walks /sys/block/<dev>/device, the symlink into the kernel's
+// device tree (e.g. ../../../0:0:0:0/.../usb1/1-1:1.0/... for a USB-attached
+// SCSI LUN, vs .../pci0000:00/.../ata1/... for SATA) - the same approach
+// Plan 9's nusb/disk uses to bind SCSI LUNs on hotplug.
+func classifyDevice(name string) deviceKind {
+	if strings.HasPrefix(name, "nvme") {
+		return kindNVMe
+	}
+	target, err := os.Readlink(fmt.Sprintf("/sys/block/%s/device", name))
+	if err != nil {
+		return kindUnknown
+	}
+	if strings.Contains(target, "/usb") {
+		return kindUSB
+	}
+	return kindSATA
+}
+
+// groupSpec names an aggregation group and the member device names it
+// should sum - either parsed from a repeatable -group=name:dev1,dev2,...
+// flag, or produced by discoverZFSVdevGroups.
+type groupSpec struct {
+	name    string
+	members []string
+}
+
+// groupFlagList accumulates one groupSpec per -group flag occurrence; it
+// implements flag.Value so flag.Var can parse it like the standard library's
+// own repeatable-flag examples.
+type groupFlagList []groupSpec
+
+func (g *groupFlagList) String() string {
+	parts := make([]string, len(*g))
+	for i, gs := range *g {
+		parts[i] = fmt.Sprintf("%s:%s", gs.name, strings.Join(gs.members, ","))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (g *groupFlagList) Set(value string) error {
+	name, rest, ok := strings.Cut(value, ":")
+	if !ok || name == "" || rest == "" {
+		return fmt.Errorf("-group must be name:dev1,dev2,...; got %q", value)
+	}
+	*g = append(*g, groupSpec{name: name, members: strings.Split(rest, ",")})
+	return nil
+}
+
+// vdevPrefixes are the zpool status leading-column prefixes that introduce a
+// redundancy group worth aggregating. Bare top-level pool lines and
+// single-disk (non-redundant) vdevs are skipped, since there's nothing to
+// compare a lone disk's queue depth against.
+var vdevPrefixes = []string{"mirror-", "raidz1-", "raidz2-", "raidz3-", "draid"}
+
+// discoverZFSVdevGroups runs `zpool status -P` and turns its vdev tree into
+// one groupSpec per mirror/raidz/draid vdev, so an operator running e.g. a
+// mirror of two NVMe drives can see that mirror's combined queue depth as a
+// single row - the headline use case for a zfs-scripts repo. Returns nil
+// (not an error) if zpool isn't installed or no pools are imported; vdev
+// discovery is best-effort enrichment the monitor never depends on.
+func discoverZFSVdevGroups() []groupSpec {
+	out, err := exec.Command("zpool", "status", "-P").Output()
+	if err != nil {
+		return nil
+	}
+	return parseZpoolStatus(string(out))
+}
+
+// parseZpoolStatus walks the indentation-structured "config:" section of
+// `zpool status -P` output, collecting each vdev line's child disk paths
+// into a groupSpec, closed out once a line at or above the vdev's own
+// indent is seen (the next vdev, a log/cache/spare section, or the
+// "errors:" footer).
+func parseZpoolStatus(output string) []groupSpec {
+	var groups []groupSpec
+	inConfig := false
+	var cur *groupSpec
+	var curIndent int
+
+	closeCur := func() {
+		if cur != nil {
+			groups = append(groups, *cur)
+			cur = nil
+		}
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "config:") {
+			inConfig = true
+			continue
+		}
+		if !inConfig {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "NAME") {
+			continue // header row
+		}
+		if strings.HasPrefix(trimmed, "errors:") {
+			break
+		}
+
+		fields := strings.Fields(trimmed)
+		name := fields[0]
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+
+		isVdev := false
+		for _, p := range vdevPrefixes {
+			if strings.HasPrefix(name, p) {
+				isVdev = true
+				break
+			}
+		}
+		if isVdev {
+			closeCur()
+			cur = &groupSpec{name: name}
+			curIndent = indent
+			continue
+		}
+
+		if cur != nil && indent > curIndent {
+			cur.members = append(cur.members, deviceNameFromVdevPath(name))
+			continue
+		}
+		closeCur()
+	}
+	closeCur()
+
+	// Drop single-disk "groups" - a vdev with fewer than two members isn't
+	// a redundancy group worth aggregating.
+	var filtered []groupSpec
+	for _, g := range groups {
+		if len(g.members) >= 2 {
+			filtered = append(filtered, g)
+		}
+	}
+	return filtered
+}
+
+// deviceNameFromVdevPath maps a zpool status -P member path (e.g.
+// /dev/sdb1 or /dev/disk/by-id/ata-...-part1) back to the /sys/block device
+// name buildDevices works with, by resolving symlinks and stripping any
+// trailing partition suffix.
+func deviceNameFromVdevPath(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		return path // already a bare name (e.g. an unresolvable entry)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		resolved = path
+	}
+	return stripPartitionSuffix(filepath.Base(resolved))
+}
+
+// stripPartitionSuffix turns a partition device name (sda1, nvme0n1p1) into
+// its parent whole-disk name, matching what discoverDevices enumerates.
+func stripPartitionSuffix(name string) string {
+	if strings.HasPrefix(name, "nvme") {
+		if i := strings.LastIndex(name, "p"); i > 0 {
+			if _, err := strconv.Atoi(name[i+1:]); err == nil {
+				return name[:i]
+			}
+		}
+		return name
+	}
+	i := len(name)
+	for i > 0 && name[i-1] >= '0' && name[i-1] <= '9' {
+		i--
+	}
+	return name[:i]
+}
+
+// deviceCurrent pairs a live queue-depth sample with the device-set
+// generation it was sampled from. The sampler goroutine always stamps the
+// generation of the *devices snapshot it read names/readers from, so a
+// display read that races a rescan (which swaps in a differently-sized
+// slice) sees its own stale generation fail to match and knows to treat the
+// slot as absent (-1) rather than trust a value sampled against an index
+// that may since have been reassigned to a different physical device.
+type deviceCurrent struct {
+	generation atomic.Int64
+	value      atomic.Int32
+}
+
+func (dc *deviceCurrent) store(generation int64, value int32) {
+	dc.value.Store(value)
+	dc.generation.Store(generation)
+}
+
+func (dc *deviceCurrent) load(generation int64) (int32, bool) {
+	if dc.generation.Load() != generation {
+		return -1, false
+	}
+	return dc.value.Load(), true
+}
+
+// deviceMetrics bundles a device's queue-depth sampler (the original
+// lock-free-sampled metric) with the reservoirs fed by the 1/sec
+// /sys/block/<dev>/stat deltas: read/write IOPS, read/write MB/s, and
+// average service time. last* holds the most recent rate sample, guarded by
+// SamplerState.mu like the reservoirs - queue depth needs no entry here
+// since it already has a lock-free atomic current value (deviceCurrent).
+type deviceMetrics struct {
+	queueDepth *ReservoirSampler
+	readIOPS   *ReservoirSampler
+	writeIOPS  *ReservoirSampler
+	readMBps   *ReservoirSampler // centi-MB/s, see mbpsScale
+	writeMBps  *ReservoirSampler // centi-MB/s, see mbpsScale
+	serviceMs  *ReservoirSampler // centi-ms, see svcMsScale
+
+	lastReadIOPS  int
+	lastWriteIOPS int
+	lastReadMBps  int
+	lastWriteMBps int
+	lastServiceMs int
+}
+
+func newDeviceMetrics() *deviceMetrics {
+	return &deviceMetrics{
+		queueDepth: NewReservoirSampler(reservoirSize),
+		readIOPS:   NewReservoirSampler(reservoirSize),
+		writeIOPS:  NewReservoirSampler(reservoirSize),
+		readMBps:   NewReservoirSampler(reservoirSize),
+		writeMBps:  NewReservoirSampler(reservoirSize),
+		serviceMs:  NewReservoirSampler(reservoirSize),
+	}
+}
+
+// sampler returns the reservoir backing the given metric.
+func (m *deviceMetrics) sampler(metric metricKind) *ReservoirSampler {
+	switch metric {
+	case metricReadIOPS:
+		return m.readIOPS
+	case metricWriteIOPS:
+		return m.writeIOPS
+	case metricReadMBps:
+		return m.readMBps
+	case metricWriteMBps:
+		return m.writeMBps
+	case metricServiceMs:
+		return m.serviceMs
+	default:
+		return m.queueDepth
+	}
+}
+
+// last returns the most recently observed rate sample for metric (0 for
+// queue depth, which uses the atomic current value instead).
+func (m *deviceMetrics) last(metric metricKind) int {
+	switch metric {
+	case metricReadIOPS:
+		return m.lastReadIOPS
+	case metricWriteIOPS:
+		return m.lastWriteIOPS
+	case metricReadMBps:
+		return m.lastReadMBps
+	case metricWriteMBps:
+		return m.lastWriteMBps
+	case metricServiceMs:
+		return m.lastServiceMs
+	default:
+		return 0
+	}
+}
+
+// aggGroup is a named set of member devices whose queue depth is summed
+// into its own ReservoirSampler - the generalized form of the original
+// hard-coded USB aggregate, now also covering ZFS vdev groups (auto-
+// discovered) and any operator-configured -group flags.
+type aggGroup struct {
+	name      string
+	memberIdx []int // indices into devices.names/kinds/metrics/currents
+	aggregate *ReservoirSampler
+	current   deviceCurrent
+}
+
+// devices is one full /sys/block scan: the discovered device list plus its
+// per-device metrics, readers, and live-value cells, plus the aggregation
+// groups (USB, ZFS vdevs, operator-configured) computed over them. The live
+// pointer is swapped atomically (RCU-style) whenever discovery notices a
+// drive attached or removed, so the sampler and display goroutines never
+// need state.mu just to see the device set change - mu is still used, as
+// before, to guard the mutable fields of the *ReservoirSampler objects a
+// given generation points at (count/sum/reservoir), which continue to be
+// mutated in place across batches.
+type devices struct {
+	generation  int64
+	names       []string
+	kinds       []deviceKind
+	sizes       []string
+	metrics     []*deviceMetrics
+	readers     []*InflightReader
+	statReaders []*StatReader
+	currents    []deviceCurrent
+	groups      []*aggGroup
+}
+
+// deviceEntry is the per-device working state used while assembling one
+// devices generation, before it's partitioned into devices' parallel slices.
+type deviceEntry struct {
+	name       string
+	kind       deviceKind
+	size       string
+	metrics    *deviceMetrics
+	reader     *InflightReader
+	statReader *StatReader
+}
+
+// buildDevices rescans /sys/block and produces the next devices generation.
+// Devices present in both old and the new scan carry their sampler, reader,
+// and size forward unchanged (so a rescan never discards warm reservoirs);
+// newly seen devices get a fresh empty sampler, which the sampler goroutine
+// warms up the same way startup does (Add() until IsFull(), then
+// ApplyBatch); devices no longer present have their reader closed and are
+// simply absent from the new generation - drained from the reservoir and
+// dropped from the display. old may be nil for the very first scan.
+// extraGroups carries the operator-configured -group flags; the USB kind
+// group and any ZFS vdev groups are always (re-)computed here alongside them.
+func buildDevices(generation int64, old *devices, extraGroups []groupSpec) *devices {
+	discovered := discoverDevices()
+
+	var oldIdx map[string]int
+	if old != nil {
+		oldIdx = make(map[string]int, len(old.names))
+		for i, n := range old.names {
+			oldIdx[n] = i
+		}
+	}
+
+	seen := make(map[string]bool, len(discovered))
+	var entries []deviceEntry
+	for _, name := range discovered {
+		kind := classifyDevice(name)
+		if kind == kindUnknown {
+			continue
+		}
+		seen[name] = true
+
+		if old != nil {
+			if i, ok := oldIdx[name]; ok {
+				entries = append(entries, deviceEntry{
+					name: name, kind: kind,
+					size: old.sizes[i], metrics: old.metrics[i],
+					reader: old.readers[i], statReader: old.statReaders[i],
+				})
+				continue
+			}
+		}
+
+		reader, err := NewInflightReader(name)
+		if err != nil {
+			log.Printf("Warning: cannot open inflight file for %s: %v", name, err)
+		}
+		statReader, err := NewStatReader(name)
+		if err != nil {
+			log.Printf("Warning: cannot open stat file for %s: %v", name, err)
+		}
+		entries = append(entries, deviceEntry{
+			name: name, kind: kind,
+			size: getDeviceSize(name), metrics: newDeviceMetrics(),
+			reader: reader, statReader: statReader,
+		})
+		if old != nil {
+			log.Printf("Discovered new device: %s", name)
+		}
+	}
+
+	// Non-USB devices first, then USB, each group alphabetical - preserves
+	// the original fixed layout's grouping so the display can still show a
+	// single separator before the hotplug-prone devices.
+	sort.SliceStable(entries, func(i, j int) bool {
+		iUSB, jUSB := entries[i].kind == kindUSB, entries[j].kind == kindUSB
+		if iUSB != jUSB {
+			return jUSB
+		}
+		return entries[i].name < entries[j].name
+	})
+
+	nd := &devices{generation: generation}
+	for _, e := range entries {
+		nd.names = append(nd.names, e.name)
+		nd.kinds = append(nd.kinds, e.kind)
+		nd.sizes = append(nd.sizes, e.size)
+		nd.metrics = append(nd.metrics, e.metrics)
+		nd.readers = append(nd.readers, e.reader)
+		nd.statReaders = append(nd.statReaders, e.statReader)
+	}
+	nd.currents = make([]deviceCurrent, len(nd.names))
+
+	if old != nil {
+		for name, i := range oldIdx {
+			if seen[name] {
+				continue
+			}
+			if old.readers[i] != nil {
+				old.readers[i].Close()
+			}
+			if old.statReaders[i] != nil {
+				old.statReaders[i].Close()
+			}
+			log.Printf("Device removed: %s", name)
+		}
+	}
+
+	nameIdx := make(map[string]int, len(nd.names))
+	for i, n := range nd.names {
+		nameIdx[n] = i
+	}
+	var oldGroups map[string]*aggGroup
+	if old != nil {
+		oldGroups = make(map[string]*aggGroup, len(old.groups))
+		for _, g := range old.groups {
+			oldGroups[g.name] = g
+		}
+	}
+
+	// addGroup resolves spec's member names against this generation's device
+	// set, dropping any that no longer exist; a group with fewer than two
+	// surviving members has nothing to aggregate and is skipped entirely. A
+	// group's ReservoirSampler carries over by name across rescans, same as
+	// a per-device sampler - only its member indices and (generation-gated)
+	// current value are recomputed fresh each time.
+	added := make(map[string]bool)
+	addGroup := func(spec groupSpec) {
+		if added[spec.name] {
+			return
+		}
+		var idx []int
+		for _, m := range spec.members {
+			if i, ok := nameIdx[m]; ok {
+				idx = append(idx, i)
+			}
+		}
+		if len(idx) < 2 {
+			return
+		}
+		aggregate := NewReservoirSampler(reservoirSize)
+		if g, ok := oldGroups[spec.name]; ok {
+			aggregate = g.aggregate
+		}
+		nd.groups = append(nd.groups, &aggGroup{name: spec.name, memberIdx: idx, aggregate: aggregate})
+		added[spec.name] = true
+	}
+
+	var usbMembers []string
+	for i, k := range nd.kinds {
+		if k == kindUSB {
+			usbMembers = append(usbMembers, nd.names[i])
+		}
+	}
+	if len(usbMembers) > 0 {
+		addGroup(groupSpec{name: "USB", members: usbMembers})
+	}
+	for _, spec := range extraGroups {
+		addGroup(spec)
+	}
+	for _, spec := range discoverZFSVdevGroups() {
+		addGroup(spec)
+	}
+
+	return nd
+}
+
+// formatPercentileHeader returns the header label for a percentile
+func formatPercentileHeader(pct float64) string {
+	if pct == float64(int(pct)) {
+		return fmt.Sprintf("P%d", int(pct))
+	}
+	// Use %g to preserve precision without trailing zeros
+	return fmt.Sprintf("P%g", pct)
+}
+
+// renderDevice is one display row's worth of data, snapshotted out of a
+// devices generation for the display goroutine to render lock-free.
+type renderDevice struct {
+	name    string
+	size    string
+	kind    deviceKind
+	sampler *ReservoirSampler
+	current int
+}
+
+// renderGroup is one aggregation-group row's worth of data (USB, a ZFS
+// vdev, or an operator-configured -group), snapshotted the same way as
+// renderDevice.
+type renderGroup struct {
+	name      string
+	memberCnt int
+	aggregate *ReservoirSampler
+	current   int
+}
+
 // Display renders the current state
 type Display struct {
 	batchMode       bool
 	p50Index        int
-	deviceSizes     [numDeviceSlots]string
-	usbAggregate    *ReservoirSampler
+	metric          metricKind
 	lastSampleCount uint64
 	lastTime        time.Time
 	samplesPerSec   float64
 }
 
+// scaleToBarWidth proportionally maps value into [0, maxQueuePerDev], using
+// reference as the value that should map to a full bar - the same
+// proportional scaling already used for the USB aggregate row.
+func scaleToBarWidth(value, reference int) int {
+	if reference <= 0 {
+		return 0
+	}
+	scaled := int(float64(value)/float64(reference)*float64(maxQueuePerDev) + 0.5)
+	if scaled > maxQueuePerDev {
+		scaled = maxQueuePerDev
+	}
+	return scaled
+}
+
 func (d *Display) resetCursor() {
 	if !d.batchMode {
 		// Move cursor to home position and clear screen (less flicker than exec clear)
@@ -358,16 +1284,7 @@ func (d *Display) resetCursor() {
 	}
 }
 
-// formatPercentileHeader returns the header label for a percentile
-func formatPercentileHeader(pct float64) string {
-	if pct == float64(int(pct)) {
-		return fmt.Sprintf("P%d", int(pct))
-	}
-	// Use %g to preserve precision without trailing zeros
-	return fmt.Sprintf("P%g", pct)
-}
-
-func (d *Display) render(samplers [numDeviceSlots]*ReservoirSampler, currents [numDeviceSlots]int, usbAggrCurrent int, totalSamples uint64) {
+func (d *Display) render(devs []renderDevice, groups []renderGroup, totalSamples uint64) {
 	// Calculate samples/sec
 	now := time.Now()
 	if !d.lastTime.IsZero() {
@@ -384,9 +1301,9 @@ func (d *Display) render(samplers [numDeviceSlots]*ReservoirSampler, currents [n
 	timestamp := time.Now().Format("Mon Jan 02 15:04:05 2006")
 
 	if d.batchMode {
-		fmt.Fprintf(&buf, "[%s] Block I/O Queue Monitor\n", timestamp)
+		fmt.Fprintf(&buf, "[%s] Block I/O Queue Monitor [metric: %s]\n", timestamp, metricLabel(d.metric))
 	} else {
-		fmt.Fprintf(&buf, "Block I/O Queue Monitor - %s\n", timestamp)
+		fmt.Fprintf(&buf, "Block I/O Queue Monitor [metric: %s] - %s\n", metricLabel(d.metric), timestamp)
 	}
 
 	// Build dynamic header
@@ -405,69 +1322,97 @@ func (d *Display) render(samplers [numDeviceSlots]*ReservoirSampler, currents [n
 	buf.WriteString(strings.Repeat("-", lineWidth))
 	buf.WriteString("\n")
 
-	for i := 0; i < numDeviceSlots; i++ {
-		dev := deviceNames[i]
-		// Empty string means separator line
-		if dev == "" {
+	usbCount := 0
+	for _, dv := range devs {
+		if dv.kind == kindUSB {
+			usbCount++
+		}
+	}
+
+	printedSeparator := usbCount == 0 || usbCount == len(devs)
+	for _, dv := range devs {
+		if dv.kind == kindUSB && !printedSeparator {
 			buf.WriteString("\n")
-			continue
+			printedSeparator = true
 		}
 
-		sampler := samplers[i]
-		current := currents[i]
-		pcts := calcPercentiles(sampler.GetSamples())
+		sampler := dv.sampler
+		rawCurrent := dv.current
+		scale := metricScale(d.metric)
+		pcts := sampler.Percentiles()
 		// Use true max for P100 (last percentile) instead of reservoir max
 		pcts[len(pcts)-1] = float64(sampler.GetMax())
-		avg := sampler.GetAverage()
+		for j := range pcts {
+			pcts[j] /= scale
+		}
+		avg := sampler.GetAverage() / scale
 		util := sampler.GetUtilization()
 
 		// Find P99 for bar display
 		p99Int := 0
 		for j, pct := range percentiles {
 			if pct == 99 {
-				p99Int = int(pcts[j] + 0.5)
+				p99Int = int(pcts[j]*scale + 0.5)
 				break
 			}
 		}
-		bar := makeBar(current, p99Int, maxQueuePerDev)
-		fmt.Fprintf(&buf, "%-8s %4d/%-3d %7.1f%%", dev, current, maxQueuePerDev, util)
+		barRef := sampler.GetMax()
+		if d.metric == metricQueueDepth {
+			barRef = maxQueuePerDev
+		}
+		bar := makeBar(scaleToBarWidth(rawCurrent, barRef), scaleToBarWidth(p99Int, barRef), maxQueuePerDev)
+
+		if d.metric == metricQueueDepth {
+			fmt.Fprintf(&buf, "%-8s %4d/%-3d %7.1f%%", dv.name, rawCurrent, maxQueuePerDev, util)
+		} else {
+			fmt.Fprintf(&buf, "%-8s %8.2f %7.1f%%", dv.name, float64(rawCurrent)/scale, util)
+		}
 		for j, val := range pcts {
 			fmt.Fprintf(&buf, " %8.2f", val)
 			if j == d.p50Index {
 				fmt.Fprintf(&buf, " %8.2f", avg)
 			}
 		}
-		devWithSize := fmt.Sprintf("%s(%s)", dev, d.deviceSizes[i])
-		fmt.Fprintf(&buf, "  %-11s  [%s]  %-8s%4d\n", devWithSize, bar, dev, int(avg+0.5))
+		devWithSize := fmt.Sprintf("%s(%s)", dv.name, dv.size)
+		fmt.Fprintf(&buf, "  %-11s  [%s]  %-8s%4d\n", devWithSize, bar, dv.name, int(avg+0.5))
+	}
 
-		// After last USB device, show aggregate USB stats
-		if i == devSdg {
-			aggrPcts := calcPercentiles(d.usbAggregate.GetSamples())
+	if d.metric == metricQueueDepth {
+		// Aggregation groups (USB disks, ZFS vdevs, operator-configured via
+		// -group) only track combined queue depth; other metrics have no
+		// summed equivalent defined yet, so this section is skipped for them.
+		for _, g := range groups {
+			maxGroupQueue := maxQueuePerDev * g.memberCnt
+			if maxGroupQueue == 0 {
+				maxGroupQueue = maxQueuePerDev
+			}
+
+			pcts := g.aggregate.Percentiles()
 			// Use true max for P100 (last percentile) instead of reservoir max
-			aggrPcts[len(aggrPcts)-1] = float64(d.usbAggregate.GetMax())
-			aggrAvg := d.usbAggregate.GetAverage()
-			aggrUtil := d.usbAggregate.GetUtilization()
+			pcts[len(pcts)-1] = float64(g.aggregate.GetMax())
+			avg := g.aggregate.GetAverage()
+			util := g.aggregate.GetUtilization()
 
-			fmt.Fprintf(&buf, "%-8s %4d/%-3d %7.1f%%", "USB", usbAggrCurrent, maxQueueUSBAggr, aggrUtil)
-			for j, val := range aggrPcts {
+			fmt.Fprintf(&buf, "%-8s %4d/%-3d %7.1f%%", g.name, g.current, maxGroupQueue, util)
+			for j, val := range pcts {
 				fmt.Fprintf(&buf, " %8.2f", val)
 				if j == d.p50Index {
-					fmt.Fprintf(&buf, " %8.2f", aggrAvg)
+					fmt.Fprintf(&buf, " %8.2f", avg)
 				}
 			}
-			// Scaled utilization bar: scale from 0-150 to 0-30 for display
-			scaledCurrent := int(float64(usbAggrCurrent) / float64(maxQueueUSBAggr) * float64(maxQueuePerDev) + 0.5)
-			aggrP99 := 0.0
+			// Scaled utilization bar: scale from 0-maxGroupQueue to 0-maxQueuePerDev for display
+			scaledCurrent := int(float64(g.current)/float64(maxGroupQueue)*float64(maxQueuePerDev) + 0.5)
+			p99 := 0.0
 			for j, pct := range percentiles {
 				if pct == 99 {
-					aggrP99 = aggrPcts[j]
+					p99 = pcts[j]
 					break
 				}
 			}
-			scaledP99 := int(aggrP99 / float64(maxQueueUSBAggr) * float64(maxQueuePerDev) + 0.5)
-			aggrBar := makeBar(scaledCurrent, scaledP99, maxQueuePerDev)
-			scaledAvg := int(aggrAvg / float64(maxQueueUSBAggr) * float64(maxQueuePerDev) + 0.5)
-			fmt.Fprintf(&buf, "  %-11s  [%s]  %-8s%4d\n", "", aggrBar, "USB", scaledAvg)
+			scaledP99 := int(p99/float64(maxGroupQueue)*float64(maxQueuePerDev) + 0.5)
+			bar := makeBar(scaledCurrent, scaledP99, maxQueuePerDev)
+			scaledAvg := int(avg/float64(maxGroupQueue)*float64(maxQueuePerDev) + 0.5)
+			fmt.Fprintf(&buf, "  %-11s  [%s]  %-8s%4d\n", "", bar, g.name, scaledAvg)
 		}
 	}
 
@@ -478,8 +1423,17 @@ func (d *Display) render(samplers [numDeviceSlots]*ReservoirSampler, currents [n
 		buf.WriteString("Legend: █= current  ░= p99 (long-term)  -= unused\n")
 	}
 
-	reservoirCount := len(samplers[devSda].GetSamples())
-	fmt.Fprintf(&buf, "Samples: %s total (%d in reservoir) @ %.0f/sec\n", formatCount(totalSamples), reservoirCount, d.samplesPerSec)
+	sampleSetSize := 0
+	sampleSetLabel := "reservoir"
+	if len(devs) > 0 {
+		if devs[0].sampler.digest != nil {
+			sampleSetSize = len(devs[0].sampler.digest.centroids)
+			sampleSetLabel = "t-digest centroids"
+		} else {
+			sampleSetSize = len(devs[0].sampler.GetSamples())
+		}
+	}
+	fmt.Fprintf(&buf, "Samples: %s total (%d %s) @ %.0f/sec\n", formatCount(totalSamples), sampleSetSize, sampleSetLabel, d.samplesPerSec)
 
 	if d.batchMode {
 		buf.WriteString("\n")
@@ -490,85 +1444,228 @@ func (d *Display) render(samplers [numDeviceSlots]*ReservoirSampler, currents [n
 	fmt.Print(buf.String())
 }
 
-// SamplerState holds the shared state between sampler and display goroutines
-// Using fixed-size array indexed by device constants (no map overhead)
+// SamplerState guards the mutable fields (count/sum/reservoir) of whichever
+// *ReservoirSampler objects the currently-loaded devices generation points
+// at. Which samplers exist, and in what order, is governed by the atomic
+// devices pointer instead, so device hotplug never needs this lock.
 type SamplerState struct {
-	mu           sync.RWMutex
-	samplers     [numDeviceSlots]*ReservoirSampler
-	usbAggregate *ReservoirSampler
+	mu sync.RWMutex
+}
+
+// batchAccum accumulates one device's (or the USB aggregate's) batch
+// statistics locally, outside the shared lock, for sampleBatchSize samples
+// before being folded into the real *ReservoirSampler. In t-digest mode,
+// digest replaces updates as the thing built lock-free and later merged.
+type batchAccum struct {
+	warmupDone bool
+	values     []int       // raw values (warmup only)
+	count      uint64      // batch sample count
+	sum        uint64      // batch sum
+	nonZero    uint64      // batch non-zero count
+	max        int         // batch max
+	updates    map[int]int // reservoir slot -> value (post-warmup, reservoir mode)
+	digest     *TDigest    // local digest built lock-free (post-warmup, t-digest mode)
+	rngState   uint64      // local RNG for reservoir sampling
+	baseCount  uint64      // sampler.count as of the last flush
 }
 
-// Atomics for current values (lock-free access for display)
-// Using fixed-size array indexed by device constants (no map overhead)
-type CurrentValues struct {
-	values      [numDeviceSlots]atomic.Int32
-	usbAggrCurr atomic.Int32
+func newBatchAccum(seed uint64) *batchAccum {
+	acc := &batchAccum{
+		values:   make([]int, 0, sampleBatchSize),
+		rngState: seed | 1,
+	}
+	if quantileConfig.tdigest {
+		acc.digest = NewTDigest(quantileConfig.delta)
+	} else {
+		acc.updates = make(map[int]int, 128)
+	}
+	return acc
+}
+
+// accumulate folds one post-warmup sample into acc: running stats update
+// locally, then either a direct digest insert (t-digest mode) or, if the
+// reservoir's random draw selects it, a pre-computed slot update (reservoir
+// mode) - all without touching the shared sampler or its lock.
+func accumulate(acc *batchAccum, value int) {
+	acc.count++
+	acc.sum += uint64(value)
+	if value > 0 {
+		acc.nonZero++
+	}
+	if value > acc.max {
+		acc.max = value
+	}
+	if acc.digest != nil {
+		acc.digest.Add(float64(value))
+		return
+	}
+	totalCount := acc.baseCount + acc.count
+	acc.rngState ^= acc.rngState << 13
+	acc.rngState ^= acc.rngState >> 7
+	acc.rngState ^= acc.rngState << 17
+	slot := acc.rngState % totalCount
+	if slot < uint64(reservoirSize) {
+		acc.updates[int(slot)] = value
+	}
+}
+
+// inflightSnapshot is one device's (or the USB aggregate's) queue-depth
+// gauges and quantiles, copied out of a *ReservoirSampler under
+// SamplerState.mu so promCollector can format the scrape response after
+// unlocking, rather than holding the lock across all the Fprintf calls.
+type inflightSnapshot struct {
+	device  string
+	current int
+	avg     float64
+	util    float64
+	max     int
+	pcts    []float64
+}
+
+func snapshotInflight(device string, current int, s *ReservoirSampler) inflightSnapshot {
+	pcts := s.Percentiles()
+	pcts[len(pcts)-1] = float64(s.GetMax()) // true max for P100, as in Display.render
+	return inflightSnapshot{
+		device:  device,
+		current: current,
+		avg:     s.GetAverage(),
+		util:    s.GetUtilization(),
+		max:     s.GetMax(),
+		pcts:    pcts,
+	}
+}
+
+// quantileLabel formats a percentile (0-100) as the Prometheus convention
+// fractional quantile label (0-1), e.g. 99.9 -> "0.999".
+func quantileLabel(pct float64) string {
+	return strconv.FormatFloat(pct/100.0, 'g', -1, 64)
+}
+
+// groupDeviceLabel formats an aggregation group's name as its Prometheus
+// device label, e.g. "USB" -> "usb_aggregate", "mirror-0" -> "mirror-0_aggregate".
+func groupDeviceLabel(name string) string {
+	return strings.ToLower(name) + "_aggregate"
+}
+
+// promCollector renders the current devices snapshot as Prometheus text
+// exposition for the queue-depth ("inflight") metric family. It takes
+// state.mu.RLock() exactly once per scrape to copy out every per-device
+// reservoir/scalar it needs via snapshotInflight, then formats the response
+// after unlocking - no extra work lands on the sampler hot loop.
+type promCollector struct {
+	devicesPtr *atomic.Pointer[devices]
+	state      *SamplerState
+}
+
+func (pc *promCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ds := pc.devicesPtr.Load()
+
+	var snaps []inflightSnapshot
+	pc.state.mu.RLock()
+	for i, name := range ds.names {
+		current := 0
+		if v, ok := ds.currents[i].load(ds.generation); ok {
+			current = int(v)
+		}
+		snaps = append(snaps, snapshotInflight(name, current, ds.metrics[i].queueDepth))
+	}
+	for _, g := range ds.groups {
+		current := 0
+		if v, ok := g.current.load(ds.generation); ok {
+			current = int(v)
+		}
+		snaps = append(snaps, snapshotInflight(groupDeviceLabel(g.name), current, g.aggregate))
+	}
+	pc.state.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	fmt.Fprintln(w, "# HELP blockio_inflight_current Current in-flight I/O queue depth.")
+	fmt.Fprintln(w, "# TYPE blockio_inflight_current gauge")
+	for _, s := range snaps {
+		fmt.Fprintf(w, "blockio_inflight_current{device=\"%s\"} %d\n", s.device, s.current)
+	}
+
+	fmt.Fprintln(w, "# HELP blockio_inflight_util_ratio Fraction of samples with a non-zero queue depth.")
+	fmt.Fprintln(w, "# TYPE blockio_inflight_util_ratio gauge")
+	for _, s := range snaps {
+		fmt.Fprintf(w, "blockio_inflight_util_ratio{device=\"%s\"} %f\n", s.device, s.util/100.0)
+	}
+
+	fmt.Fprintln(w, "# HELP blockio_inflight_avg Running average queue depth over the sampler's lifetime.")
+	fmt.Fprintln(w, "# TYPE blockio_inflight_avg gauge")
+	for _, s := range snaps {
+		fmt.Fprintf(w, "blockio_inflight_avg{device=\"%s\"} %f\n", s.device, s.avg)
+	}
+
+	fmt.Fprintln(w, "# HELP blockio_inflight_max True maximum queue depth ever observed.")
+	fmt.Fprintln(w, "# TYPE blockio_inflight_max gauge")
+	for _, s := range snaps {
+		fmt.Fprintf(w, "blockio_inflight_max{device=\"%s\"} %d\n", s.device, s.max)
+	}
+
+	fmt.Fprintln(w, "# HELP blockio_inflight_quantile Queue-depth quantiles from the -quantiles engine (reservoir sample or t-digest).")
+	fmt.Fprintln(w, "# TYPE blockio_inflight_quantile gauge")
+	for _, s := range snaps {
+		for j, pct := range percentiles {
+			fmt.Fprintf(w, "blockio_inflight_quantile{device=\"%s\",quantile=\"%s\"} %f\n", s.device, quantileLabel(pct), s.pcts[j])
+		}
+	}
 }
 
 func main() {
 	batchMode := flag.Bool("batch", false, "Enable batch mode (no screen clearing, suitable for nohup)")
+	metricFlag := flag.String("metric", "queue", "Metric driving the bar/percentile columns: queue, r-iops, w-iops, r-mbps, w-mbps, svc-ms")
+	listenAddr := flag.String("listen", "", "address to serve a Prometheus /metrics endpoint on (e.g. :9100); empty disables it")
+	metricsOnly := flag.Bool("metrics-only", false, "suppress the interactive TUI; only serve -listen (for running as a headless/systemd service)")
+	quantilesFlag := flag.String("quantiles", "reservoir", "quantile estimation engine: reservoir (uniform sample, sorted per render) or tdigest (weighted centroids, accurate deep tails)")
+	tdigestDelta := flag.Float64("tdigest-delta", 100, "t-digest compression parameter (higher = more accurate, more memory); only used with -quantiles=tdigest")
+	var groupSpecs groupFlagList
+	flag.Var(&groupSpecs, "group", "aggregation group name:dev1,dev2,... (repeatable); USB-kind devices and any ZFS vdevs (via `zpool status -P`) are grouped automatically alongside these")
 	flag.Parse()
 
+	if *metricsOnly && *listenAddr == "" {
+		log.Fatal("-metrics-only requires -listen to be set")
+	}
+
+	switch *quantilesFlag {
+	case "reservoir":
+		quantileConfig.tdigest = false
+	case "tdigest":
+		quantileConfig.tdigest = true
+		quantileConfig.delta = *tdigestDelta
+	default:
+		log.Fatalf("-quantiles must be 'reservoir' or 'tdigest', got %q", *quantilesFlag)
+	}
+
+	metric, err := parseMetricFlag(*metricFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// Setup logging
 	if *batchMode {
 		log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds)
 		log.Println("Block I/O Queue Monitor starting in batch mode")
 	}
 
-	// Initialize samplers for each device (slice indexed by device constants)
-	var samplers [numDeviceSlots]*ReservoirSampler
-	for i := 0; i < numDeviceSlots; i++ {
-		if deviceNames[i] == "" {
-			continue
-		}
-		samplers[i] = NewReservoirSampler(reservoirSize)
-	}
-
 	p50Index := findP50Index()
 	if p50Index == -1 {
 		log.Fatal("P50 must be present in percentiles array")
 	}
 
-	// Get device sizes at startup (fixed-size array)
-	var deviceSizes [numDeviceSlots]string
-	for i := 0; i < numDeviceSlots; i++ {
-		if deviceNames[i] == "" {
-			continue
-		}
-		deviceSizes[i] = getDeviceSize(deviceNames[i])
-	}
-
-	// Create aggregate sampler for combined USB queue depth
-	usbAggregate := NewReservoirSampler(reservoirSize)
-
-	// Initialize atomic current values (fixed-size array, no map)
-	currents := &CurrentValues{}
-
-	// Open persistent file handles for fast sysfs reads (slice indexed by device constants)
-	var readers [numDeviceSlots]*InflightReader
-	for i := 0; i < numDeviceSlots; i++ {
-		if deviceNames[i] == "" {
-			continue
-		}
-		reader, err := NewInflightReader(deviceNames[i])
-		if err != nil {
-			log.Printf("Warning: cannot open inflight file for %s: %v", deviceNames[i], err)
-			continue
-		}
-		readers[i] = reader
-	}
+	// Initial /sys/block scan; devicesPtr is the RCU-style live pointer every
+	// goroutine reads through, swapped wholesale on each rescan.
+	var devicesPtr atomic.Pointer[devices]
+	devicesPtr.Store(buildDevices(0, nil, groupSpecs))
 
 	// Shared state protected by RWMutex for sampler data
-	state := &SamplerState{
-		samplers:     samplers,
-		usbAggregate: usbAggregate,
-	}
+	state := &SamplerState{}
 
 	display := &Display{
-		batchMode:    *batchMode,
-		p50Index:     p50Index,
-		deviceSizes:  deviceSizes,
-		usbAggregate: usbAggregate,
+		batchMode: *batchMode,
+		p50Index:  p50Index,
+		metric:    metric,
 	}
 
 	// Setup signal handling for clean shutdown
@@ -579,121 +1676,195 @@ func main() {
 	done := make(chan struct{})
 
 	// Initial message
-	if !*batchMode {
+	if *metricsOnly {
+		log.Println("Starting sampler (dedicated CPU); TUI disabled (-metrics-only)")
+	} else if !*batchMode {
 		fmt.Println("Block I/O Queue Monitor - Ctrl+C to stop")
 		fmt.Println("Starting sampler (dedicated CPU) and display (60 FPS)...")
 	} else {
 		log.Println("Starting sampler (dedicated CPU) and display...")
 	}
 
+	// Prometheus /metrics endpoint (non-destructive: snapshots via
+	// state.mu.RLock, same as the display goroutine, so it can run
+	// concurrently with the TUI without disturbing either).
+	if *listenAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", &promCollector{devicesPtr: &devicesPtr, state: state})
+		go func() {
+			log.Printf("Serving Prometheus metrics on %s/metrics", *listenAddr)
+			if err := http.ListenAndServe(*listenAddr, mux); err != nil {
+				log.Printf("Prometheus metrics server stopped: %v", err)
+			}
+		}()
+	}
+
 	// SAMPLER GOROUTINE - runs flat out, no sleep, hogs one CPU core
 	var sampleCount atomic.Uint64
 	go func() {
-		// Batch accumulator for pre-computing stats outside lock
-		type batchAccum struct {
-			values    []int       // raw values (warmup only)
-			count     uint64      // batch sample count
-			sum       uint64      // batch sum
-			nonZero   uint64      // batch non-zero count
-			max       int         // batch max
-			updates   map[int]int // reservoir slot -> value (post-warmup)
-			rngState  uint64      // local RNG for reservoir sampling
-			baseCount uint64      // sampler.count at batch start
-		}
-
-		// Per-device accumulators
-		var accums [numDeviceSlots]*batchAccum
-		for i := 0; i < numDeviceSlots; i++ {
-			if deviceNames[i] != "" {
-				accums[i] = &batchAccum{
-					values:   make([]int, 0, sampleBatchSize),
-					updates:  make(map[int]int, 128),
-					rngState: uint64(time.Now().UnixNano()) + uint64(i)*12345 | 1,
-				}
-			}
-		}
-		// USB aggregate accumulator
-		usbAccum := &batchAccum{
-			values:   make([]int, 0, sampleBatchSize),
-			updates:  make(map[int]int, 128),
-			rngState: uint64(time.Now().UnixNano()) + 99999 | 1,
-		}
+		// Per-device batch accumulators, keyed by name so they survive a
+		// rescan that reshuffles slot order (or grows/shrinks the device
+		// list) without losing in-flight warmup/batch state.
+		accums := make(map[string]*batchAccum)
+		accumSeed := uint64(time.Now().UnixNano())
+
+		// Per-group batch accumulators, keyed by group name for the same
+		// rescan-survival reason as accums.
+		groupAccums := make(map[string]*batchAccum)
+
+		// currentsBuf holds this iteration's per-device queue depth, reused
+		// across iterations (resized only when the device count changes) so
+		// group-sum computation below doesn't allocate on the hot path.
+		var currentsBuf []int
+
+		rescanTicker := time.NewTicker(deviceRescanInterval)
+		defer rescanTicker.Stop()
+
+		// statPrev/statPrevTime track the last /sys/block/<dev>/stat reading
+		// per device, so statTicker can compute rate deltas; sampler-goroutine
+		// local state only, cleaned up alongside accums on device removal.
+		statPrev := make(map[string]blockStat)
+		statPrevTime := make(map[string]time.Time)
+		statTicker := time.NewTicker(statSampleInterval)
+		defer statTicker.Stop()
 
 		batchCount := 0
-		warmupDone := false
 
 		for {
 			select {
 			case <-done:
 				return
-			default:
-				// Phase 1: Read sysfs + accumulate batch stats locally (no lock)
-				usbSum := 0
-				for i := 0; i < numDeviceSlots; i++ {
-					if deviceNames[i] == "" {
-						continue
+			case <-rescanTicker.C:
+				old := devicesPtr.Load()
+				nd := buildDevices(old.generation+1, old, groupSpecs)
+				live := make(map[string]bool, len(nd.names))
+				for _, n := range nd.names {
+					live[n] = true
+				}
+				for name := range accums {
+					if !live[name] {
+						delete(accums, name)
 					}
-					reader := readers[i]
-					if reader == nil {
+				}
+				for name := range statPrev {
+					if !live[name] {
+						delete(statPrev, name)
+						delete(statPrevTime, name)
+					}
+				}
+				liveGroups := make(map[string]bool, len(nd.groups))
+				for _, g := range nd.groups {
+					liveGroups[g.name] = true
+				}
+				for name := range groupAccums {
+					if !liveGroups[name] {
+						delete(groupAccums, name)
+					}
+				}
+				devicesPtr.Store(nd)
+			case <-statTicker.C:
+				ds := devicesPtr.Load()
+				now := time.Now()
+				for i, name := range ds.names {
+					sr := ds.statReaders[i]
+					if sr == nil {
 						continue
 					}
-					current, err := reader.Read()
+					cur, err := sr.Read()
 					if err != nil {
-						current = 0
+						continue
+					}
+					prev, havePrev := statPrev[name]
+					prevTime := statPrevTime[name]
+					statPrev[name] = cur
+					statPrevTime[name] = now
+					if !havePrev {
+						continue
+					}
+					dt := now.Sub(prevTime).Seconds()
+					if dt <= 0 {
+						continue
+					}
+
+					dReads := diffUint64(cur.readsCompleted, prev.readsCompleted)
+					dWrites := diffUint64(cur.writesCompleted, prev.writesCompleted)
+					dSectorsR := diffUint64(cur.sectorsRead, prev.sectorsRead)
+					dSectorsW := diffUint64(cur.sectorsWritten, prev.sectorsWritten)
+					dBusyMs := diffUint64(cur.msDoingIO, prev.msDoingIO)
+
+					rIOPS := int(float64(dReads)/dt + 0.5)
+					wIOPS := int(float64(dWrites)/dt + 0.5)
+					rMBps := int(float64(dSectorsR)*512.0/(1024*1024)/dt*mbpsScale + 0.5)
+					wMBps := int(float64(dSectorsW)*512.0/(1024*1024)/dt*mbpsScale + 0.5)
+					svcMs := 0
+					if totalIOs := dReads + dWrites; totalIOs > 0 {
+						svcMs = int(float64(dBusyMs)/float64(totalIOs)*svcMsScale + 0.5)
 					}
 
-					acc := accums[i]
-					if !warmupDone {
+					m := ds.metrics[i]
+					state.mu.Lock()
+					m.readIOPS.Add(rIOPS)
+					m.writeIOPS.Add(wIOPS)
+					m.readMBps.Add(rMBps)
+					m.writeMBps.Add(wMBps)
+					m.serviceMs.Add(svcMs)
+					m.lastReadIOPS, m.lastWriteIOPS = rIOPS, wIOPS
+					m.lastReadMBps, m.lastWriteMBps = rMBps, wMBps
+					m.lastServiceMs = svcMs
+					state.mu.Unlock()
+				}
+			default:
+				// Phase 1: Read sysfs + accumulate batch stats locally (no lock)
+				ds := devicesPtr.Load()
+				if len(currentsBuf) != len(ds.names) {
+					currentsBuf = make([]int, len(ds.names))
+				}
+
+				for i, name := range ds.names {
+					current := 0
+					if reader := ds.readers[i]; reader != nil {
+						if v, err := reader.Read(); err == nil {
+							current = v
+						}
+					}
+
+					acc, ok := accums[name]
+					if !ok {
+						accumSeed++
+						acc = newBatchAccum(accumSeed)
+						accums[name] = acc
+					}
+					if !acc.warmupDone {
 						// Warmup: store raw values
 						acc.values = append(acc.values, current)
 					} else {
 						// Post-warmup: compute stats locally
-						acc.count++
-						acc.sum += uint64(current)
-						if current > 0 {
-							acc.nonZero++
-						}
-						if current > acc.max {
-							acc.max = current
-						}
-						// Pre-compute reservoir update
-						totalCount := acc.baseCount + acc.count
-						acc.rngState ^= acc.rngState << 13
-						acc.rngState ^= acc.rngState >> 7
-						acc.rngState ^= acc.rngState << 17
-						slot := acc.rngState % totalCount
-						if slot < uint64(reservoirSize) {
-							acc.updates[int(slot)] = current
-						}
+						accumulate(acc, current)
 					}
-					currents.values[i].Store(int32(current))
-				}
 
-				// USB aggregate
-				for _, idx := range usbDeviceIndices {
-					usbSum += int(currents.values[idx].Load())
+					ds.currents[i].store(ds.generation, int32(current))
+					currentsBuf[i] = current
 				}
-				if !warmupDone {
-					usbAccum.values = append(usbAccum.values, usbSum)
-				} else {
-					usbAccum.count++
-					usbAccum.sum += uint64(usbSum)
-					if usbSum > 0 {
-						usbAccum.nonZero++
+
+				for _, g := range ds.groups {
+					sum := 0
+					for _, idx := range g.memberIdx {
+						sum += currentsBuf[idx]
 					}
-					if usbSum > usbAccum.max {
-						usbAccum.max = usbSum
+
+					gAcc, ok := groupAccums[g.name]
+					if !ok {
+						accumSeed++
+						gAcc = newBatchAccum(accumSeed)
+						groupAccums[g.name] = gAcc
 					}
-					totalCount := usbAccum.baseCount + usbAccum.count
-					usbAccum.rngState ^= usbAccum.rngState << 13
-					usbAccum.rngState ^= usbAccum.rngState >> 7
-					usbAccum.rngState ^= usbAccum.rngState << 17
-					slot := usbAccum.rngState % totalCount
-					if slot < uint64(reservoirSize) {
-						usbAccum.updates[int(slot)] = usbSum
+					if !gAcc.warmupDone {
+						gAcc.values = append(gAcc.values, sum)
+					} else {
+						accumulate(gAcc, sum)
 					}
+					g.current.store(ds.generation, int32(sum))
 				}
-				currents.usbAggrCurr.Store(int32(usbSum))
 
 				sampleCount.Add(1)
 				batchCount++
@@ -702,60 +1873,60 @@ func main() {
 				if batchCount >= sampleBatchSize {
 					state.mu.Lock()
 
-					if !warmupDone {
-						// Warmup: call Add() to fill reservoirs
-						for i := 0; i < numDeviceSlots; i++ {
-							if state.samplers[i] == nil || accums[i] == nil {
-								continue
-							}
-							for _, v := range accums[i].values {
-								state.samplers[i].Add(v)
-							}
-							accums[i].values = accums[i].values[:0]
-						}
-						for _, v := range usbAccum.values {
-							state.usbAggregate.Add(v)
+					for i, name := range ds.names {
+						acc := accums[name]
+						if acc == nil {
+							continue
 						}
-						usbAccum.values = usbAccum.values[:0]
-
-						// Check if warmup complete
-						allFull := true
-						for i := 0; i < numDeviceSlots; i++ {
-							if state.samplers[i] != nil && !state.samplers[i].IsFull() {
-								allFull = false
-								break
+						sampler := ds.metrics[i].queueDepth
+						if !acc.warmupDone {
+							// Warmup: call Add() to fill reservoir
+							for _, v := range acc.values {
+								sampler.Add(v)
 							}
-						}
-						if allFull && state.usbAggregate.IsFull() {
-							warmupDone = true
-							// Capture base counts for probability calculation
-							for i := 0; i < numDeviceSlots; i++ {
-								if accums[i] != nil && state.samplers[i] != nil {
-									accums[i].baseCount = state.samplers[i].count
-								}
-							}
-							usbAccum.baseCount = state.usbAggregate.count
-						}
-					} else {
-						// Post-warmup: apply pre-computed deltas (minimal lock time)
-						for i := 0; i < numDeviceSlots; i++ {
-							if state.samplers[i] == nil || accums[i] == nil {
-								continue
+							acc.values = acc.values[:0]
+							if sampler.IsFull() {
+								acc.warmupDone = true
+								acc.baseCount = sampler.count
 							}
-							acc := accums[i]
-							state.samplers[i].ApplyBatch(acc.count, acc.sum, acc.nonZero, acc.max, acc.updates)
-							// Reset accumulator, capture new base count
-							acc.baseCount = state.samplers[i].count
+						} else {
+							// Post-warmup: apply pre-computed deltas (minimal lock time)
+							sampler.ApplyBatch(acc.count, acc.sum, acc.nonZero, acc.max, acc.updates, acc.digest)
+							acc.baseCount = sampler.count
 							acc.count, acc.sum, acc.nonZero, acc.max = 0, 0, 0, 0
 							for k := range acc.updates {
 								delete(acc.updates, k)
 							}
+							if acc.digest != nil {
+								acc.digest = NewTDigest(quantileConfig.delta)
+							}
 						}
-						state.usbAggregate.ApplyBatch(usbAccum.count, usbAccum.sum, usbAccum.nonZero, usbAccum.max, usbAccum.updates)
-						usbAccum.baseCount = state.usbAggregate.count
-						usbAccum.count, usbAccum.sum, usbAccum.nonZero, usbAccum.max = 0, 0, 0, 0
-						for k := range usbAccum.updates {
-							delete(usbAccum.updates, k)
+					}
+
+					for _, g := range ds.groups {
+						gAcc := groupAccums[g.name]
+						if gAcc == nil {
+							continue
+						}
+						if !gAcc.warmupDone {
+							for _, v := range gAcc.values {
+								g.aggregate.Add(v)
+							}
+							gAcc.values = gAcc.values[:0]
+							if g.aggregate.IsFull() {
+								gAcc.warmupDone = true
+								gAcc.baseCount = g.aggregate.count
+							}
+						} else {
+							g.aggregate.ApplyBatch(gAcc.count, gAcc.sum, gAcc.nonZero, gAcc.max, gAcc.updates, gAcc.digest)
+							gAcc.baseCount = g.aggregate.count
+							gAcc.count, gAcc.sum, gAcc.nonZero, gAcc.max = 0, 0, 0, 0
+							for k := range gAcc.updates {
+								delete(gAcc.updates, k)
+							}
+							if gAcc.digest != nil {
+								gAcc.digest = NewTDigest(quantileConfig.delta)
+							}
 						}
 					}
 
@@ -766,70 +1937,75 @@ func main() {
 		}
 	}()
 
-	// DISPLAY GOROUTINE - runs at ~20 FPS (50ms)
-	displayTicker := time.NewTicker(displayInterval)
-	go func() {
-		defer displayTicker.Stop()
-		for {
-			select {
-			case <-done:
-				return
-			case <-displayTicker.C:
-				// Read current values (lock-free atomics, direct index access)
-				var currentValues [numDeviceSlots]int
-				for i := 0; i < numDeviceSlots; i++ {
-					currentValues[i] = int(currents.values[i].Load())
-				}
-				usbAggrCurrent := int(currents.usbAggrCurr.Load())
-
-				// Snapshot scalars under lock (fast: just 5 uint64s per device)
-				var samplersCopy [numDeviceSlots]*ReservoirSampler
-				state.mu.RLock()
-				for i := 0; i < numDeviceSlots; i++ {
-					s := state.samplers[i]
-					if s == nil {
-						continue
+	// DISPLAY GOROUTINE - runs at ~20 FPS (50ms); skipped entirely in
+	// -metrics-only mode, where only the Prometheus endpoint serves data.
+	if !*metricsOnly {
+		displayTicker := time.NewTicker(displayInterval)
+		go func() {
+			defer displayTicker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-displayTicker.C:
+					ds := devicesPtr.Load()
+
+					// Snapshot scalars (and, in t-digest mode, a digest clone)
+					// under lock - fast, since the raw reservoir is left for
+					// the unlocked copy below.
+					devs := make([]renderDevice, len(ds.names))
+					state.mu.RLock()
+					for i, name := range ds.names {
+						s := ds.metrics[i].sampler(display.metric)
+						devs[i] = renderDevice{
+							name:    name,
+							size:    ds.sizes[i],
+							kind:    ds.kinds[i],
+							sampler: s.Snapshot(),
+							current: ds.metrics[i].last(display.metric), // rate metrics; queue depth is set below
+						}
 					}
-					// Copy only scalars under lock (36 bytes per device)
-					samplersCopy[i] = &ReservoirSampler{
-						count:   s.count,
-						sum:     s.sum,
-						nonZero: s.nonZero,
-						max:     s.max,
-						size:    s.size,
+					groups := make([]renderGroup, len(ds.groups))
+					for i, g := range ds.groups {
+						groups[i] = renderGroup{
+							name:      g.name,
+							memberCnt: len(g.memberIdx),
+							aggregate: g.aggregate.Snapshot(),
+						}
 					}
-				}
-				// Copy USB aggregate scalars
-				display.usbAggregate = &ReservoirSampler{
-					count:   state.usbAggregate.count,
-					sum:     state.usbAggregate.sum,
-					nonZero: state.usbAggregate.nonZero,
-					max:     state.usbAggregate.max,
-					size:    state.usbAggregate.size,
-				}
-				state.mu.RUnlock()
-
-				// Copy reservoirs outside lock (slightly stale but fine for display)
-				// This avoids 90K int copies under lock
-				for i := 0; i < numDeviceSlots; i++ {
-					if samplersCopy[i] != nil && state.samplers[i] != nil {
-						samplersCopy[i].reservoir = state.samplers[i].GetSamples()
+					state.mu.RUnlock()
+
+					// Copy reservoirs and live values outside lock (slightly
+					// stale but fine for display); a value whose generation
+					// doesn't match ds.generation means the sampler goroutine
+					// raced a rescan before writing this slot - show 0 rather
+					// than a value that may belong to a different device.
+					for i := range devs {
+						devs[i].sampler.reservoir = ds.metrics[i].sampler(display.metric).GetSamples()
+						if v, ok := ds.currents[i].load(ds.generation); ok && display.metric == metricQueueDepth {
+							devs[i].current = int(v)
+						}
+					}
+					for i, g := range ds.groups {
+						groups[i].aggregate.reservoir = g.aggregate.GetSamples()
+						if v, ok := g.current.load(ds.generation); ok {
+							groups[i].current = int(v)
+						}
 					}
-				}
-				display.usbAggregate.reservoir = state.usbAggregate.GetSamples()
 
-				// Render (outside of lock)
-				display.render(samplersCopy, currentValues, usbAggrCurrent, sampleCount.Load())
+					// Render (outside of lock)
+					display.render(devs, groups, sampleCount.Load())
+				}
 			}
-		}
-	}()
+		}()
+	}
 
 	// Wait for shutdown signal
 	<-sigChan
 	close(done)
 
 	// Close persistent file handles
-	for _, reader := range readers {
+	for _, reader := range devicesPtr.Load().readers {
 		if reader != nil {
 			reader.Close()
 		}
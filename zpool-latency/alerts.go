@@ -0,0 +1,243 @@
+package main
+
+// alerts.go: `--alert` threshold rules with hysteresis, plus `--on-alert`
+// exec/webhook hooks (chunk5-6). Mirrors blk-latency's own alert.go
+// (ticker-driven evaluation against State snapshots, structured JSON
+// events, webhook-or-stderr emission) but keyed on this package's
+// quantile(op,waitType) rule syntax instead of burn-rate windows, since
+// the histogram here is already bucketed by wait type directly.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// alertRule is one parsed --alert clause, e.g.
+// "p99(write,total) > 50ms for 3 intervals".
+type alertRule struct {
+	raw          string
+	label        string // e.g. "p99"
+	quantile     float64
+	op           string // "read" or "write"
+	waitType     string // "total", "disk", "sync", or "async"
+	col          int
+	thresholdUs  float64
+	thresholdStr string // the clause's duration text as written, e.g. "50ms"
+	forIntervals int
+}
+
+var alertClausePattern = regexp.MustCompile(
+	`^p([0-9.]+)\(\s*(read|write)\s*,\s*(total|disk|sync|async)\s*\)\s*>\s*(\S+)\s+for\s+(\d+)\s+interval`)
+
+// alertColumns maps (waitType, op) to the DeviceHistogram column it
+// reads - the same pairing prometheus.go's waitOps uses for total/disk.
+var alertColumns = map[string]map[string]int{
+	"total": {"read": colTotalRead, "write": colTotalWrite},
+	"disk":  {"read": colDiskRead, "write": colDiskWrite},
+	"sync":  {"read": colSyncRead, "write": colSyncWrite},
+	"async": {"read": colAsyncRead, "write": colAsyncWrite},
+}
+
+// parseAlertRule parses one --alert clause.
+func parseAlertRule(s string) (alertRule, error) {
+	m := alertClausePattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return alertRule{}, fmt.Errorf("invalid --alert clause %q (want \"pNN(read|write,total|disk|sync|async) > DURATION for N intervals\")", s)
+	}
+	quantile, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return alertRule{}, fmt.Errorf("invalid quantile in %q: %w", s, err)
+	}
+	op, waitType := m[2], m[3]
+	threshold, err := time.ParseDuration(m[4])
+	if err != nil {
+		return alertRule{}, fmt.Errorf("invalid threshold in %q: %w", s, err)
+	}
+	forIntervals, err := strconv.Atoi(m[5])
+	if err != nil || forIntervals < 1 {
+		return alertRule{}, fmt.Errorf("invalid interval count in %q", s)
+	}
+	return alertRule{
+		raw:          s,
+		label:        "p" + m[1],
+		quantile:     quantile,
+		op:           op,
+		waitType:     waitType,
+		col:          alertColumns[waitType][op],
+		thresholdUs:  float64(threshold.Microseconds()),
+		thresholdStr: m[4],
+		forIntervals: forIntervals,
+	}, nil
+}
+
+// alertRuleList accumulates one alertRule per --alert flag occurrence,
+// implementing flag.Value the way usb-queue-monitor-v2.go's groupFlagList
+// does for -group.
+type alertRuleList []alertRule
+
+func (l *alertRuleList) String() string {
+	parts := make([]string, len(*l))
+	for i, r := range *l {
+		parts[i] = r.raw
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (l *alertRuleList) Set(value string) error {
+	rule, err := parseAlertRule(value)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, rule)
+	return nil
+}
+
+// ruleState is one (device, rule) pair's hysteresis state machine:
+// consecutive violating/non-violating intervals, and whether it's
+// currently firing.
+type ruleState struct {
+	consecutiveBad  int
+	consecutiveGood int
+	firing          bool
+}
+
+// alertEvent is the structured JSON event emitted on a fire or resolve.
+type alertEvent struct {
+	Time      string  `json:"time"`
+	Device    string  `json:"device"`
+	Rule      string  `json:"rule"`
+	State     string  `json:"state"` // "firing" or "resolved"
+	ValueUs   float64 `json:"value_us"`
+	Threshold string  `json:"threshold"`
+}
+
+// runAlertEvaluator watches intervalState for new snapshots (by
+// updateCount, the same pattern runLogger uses for -log) and evaluates
+// every rule against every device on each one. A rule only starts firing
+// after forIntervals consecutive violating snapshots, and only resolves
+// after forIntervals consecutive clean ones, so a single noisy interval
+// can't flap it.
+func runAlertEvaluator(intervalState *State, rules []alertRule, onAlert string, dryRun bool, done <-chan struct{}) {
+	if len(rules) == 0 {
+		return
+	}
+	states := make(map[string]*ruleState) // key: device + "/" + rule.raw
+
+	lastCount := uint64(0)
+	ticker := time.NewTicker(displayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			hist, _, count := intervalState.Snapshot()
+			if count == lastCount || count == 0 {
+				continue
+			}
+			lastCount = count
+
+			for dev, h := range hist {
+				for _, rule := range rules {
+					key := dev + "/" + rule.raw
+					st, ok := states[key]
+					if !ok {
+						st = &ruleState{}
+						states[key] = st
+					}
+					evaluateRule(st, dev, h, rule, onAlert, dryRun)
+				}
+			}
+		}
+	}
+}
+
+// evaluateRule updates st's hysteresis counters from h's current quantile
+// and fires/resolves rule if the run just crossed a forIntervals boundary.
+func evaluateRule(st *ruleState, dev string, h *DeviceHistogram, rule alertRule, onAlert string, dryRun bool) {
+	valueUs := newHistogramFromBuckets(deviceColumn(h, rule.col)).Percentile(rule.quantile)
+	violating := valueUs > rule.thresholdUs
+
+	if violating {
+		st.consecutiveBad++
+		st.consecutiveGood = 0
+	} else {
+		st.consecutiveGood++
+		st.consecutiveBad = 0
+	}
+
+	event := func(state string) alertEvent {
+		return alertEvent{
+			Time:      time.Now().UTC().Format(time.RFC3339),
+			Device:    dev,
+			Rule:      rule.raw,
+			State:     state,
+			ValueUs:   valueUs,
+			Threshold: rule.thresholdStr,
+		}
+	}
+
+	switch {
+	case !st.firing && st.consecutiveBad >= rule.forIntervals:
+		st.firing = true
+		fireAlert(onAlert, dryRun, event("firing"))
+	case st.firing && st.consecutiveGood >= rule.forIntervals:
+		st.firing = false
+		fireAlert(onAlert, dryRun, event("resolved"))
+	}
+}
+
+// fireAlert emits ev as JSON to stderr, then - unless dryRun - runs
+// onAlert's exec: or webhook: hook. -dry-run only logs "would fire" so
+// users can tune thresholds against a -replay file with no side effects.
+func fireAlert(onAlert string, dryRun bool, ev alertEvent) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("alert: failed to encode event: %v", err)
+		return
+	}
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "[dry-run] would %s\n", data)
+		return
+	}
+	fmt.Fprintln(os.Stderr, string(data))
+
+	switch {
+	case strings.HasPrefix(onAlert, "exec:"):
+		runExecHook(strings.TrimPrefix(onAlert, "exec:"), ev)
+	case strings.HasPrefix(onAlert, "webhook:"):
+		postWebhookHook(strings.TrimPrefix(onAlert, "webhook:"), data)
+	}
+}
+
+// runExecHook substitutes %device/%metric/%value into cmdline and runs it
+// through the shell.
+func runExecHook(cmdline string, ev alertEvent) {
+	r := strings.NewReplacer(
+		"%device", ev.Device,
+		"%metric", ev.Rule,
+		"%value", fmt.Sprintf("%.0f", ev.ValueUs),
+	)
+	cmd := exec.Command("sh", "-c", r.Replace(cmdline))
+	if err := cmd.Run(); err != nil {
+		log.Printf("alert: exec hook failed: %v", err)
+	}
+}
+
+func postWebhookHook(url string, data []byte) {
+	resp, err := http.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		log.Printf("alert: webhook post failed: %v", err)
+		return
+	}
+	resp.Body.Close()
+}
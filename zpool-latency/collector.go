@@ -0,0 +1,82 @@
+package main
+
+// collector.go: the Collector interface (chunk5-3) that abstracts how
+// per-device latency histograms are obtained, so State, Display, and
+// everything else stay unaware of whether data came from parsing `zpool
+// iostat -wvv` text or (see collector_libzfs.go, build tag `libzfs`)
+// directly from the pool's kstat vdev_histo_* arrays via ioctl.
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// Collector obtains per-device latency histograms for a pool, either as a
+// single cumulative snapshot (FetchLifetime) or as a stream of interval
+// snapshots (StreamInterval).
+type Collector interface {
+	// FetchLifetime returns one cumulative histogram snapshot for pool.
+	FetchLifetime(pool string) (map[string]*DeviceHistogram, error)
+	// StreamInterval calls fn with one interval histogram snapshot per
+	// tick until done is closed. interval is a hint, not a guarantee: the
+	// shell collector is bound by zpool iostat's own minimum granularity,
+	// while an ioctl-backed collector can sample faster.
+	StreamInterval(pool string, interval time.Duration, fn func(map[string]*DeviceHistogram), done <-chan struct{}) error
+}
+
+// defaultCollector is the Collector main() uses when nothing overrides it.
+// It's always the shell collector unless collector_libzfs.go's init (only
+// compiled with -tags libzfs) successfully opens libzfs and replaces it;
+// see newCollector.
+var defaultCollector Collector = shellCollector{}
+
+// newCollector returns the Collector live runs should use: the libzfs
+// backend if this binary was built with -tags libzfs and /dev/zfs was
+// reachable at startup, otherwise the shell backend.
+func newCollector() Collector {
+	return defaultCollector
+}
+
+// shellCollector is the original backend: it shells out to `zpool iostat
+// -wvv`, either once (FetchLifetime) or continuously (StreamInterval), and
+// parses the text table. It's forced to zpool iostat's own 10-second
+// minimum interval and pays a fork-per-poll cost for lifetime stats, but
+// needs nothing beyond a `zpool` binary on PATH.
+type shellCollector struct{}
+
+// FetchLifetime runs zpool iostat once to get cumulative stats.
+func (shellCollector) FetchLifetime(pool string) (map[string]*DeviceHistogram, error) {
+	cmd := exec.Command("zpool", "iostat", "-wvv", pool)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseZpoolOutput(bytes.NewReader(output)), nil
+}
+
+// StreamInterval starts `zpool iostat -wvv pool <interval>` and parses its
+// streaming output, calling fn once per completed interval snapshot.
+func (shellCollector) StreamInterval(pool string, interval time.Duration, fn func(map[string]*DeviceHistogram), done <-chan struct{}) error {
+	seconds := int(interval.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	cmd := exec.Command("zpool", "iostat", "-wvv", pool, fmt.Sprintf("%d", seconds))
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("getting stdout pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting zpool iostat: %w", err)
+	}
+
+	parser := newIntervalParser(fn)
+	go parser.Parse(stdout)
+
+	<-done
+	cmd.Process.Kill()
+	cmd.Wait()
+	return nil
+}
@@ -0,0 +1,135 @@
+//go:build libzfs
+
+package main
+
+// collector_libzfs.go: a Collector backed directly by the ZFS ioctl
+// (ZFS_IOC_POOL_STATS) instead of shelling out to `zpool iostat -wvv`
+// (chunk5-3). It reads each vdev's vs_histo arrays (wait_queue and
+// asyncq_wait, per op type) straight out of the nvlist vdev_stats_ex the
+// kernel already maintains, via github.com/bicomsystems/go-libzfs. That
+// removes zpool iostat's 10-second minimum interval and the fork-per-poll
+// cost of the lifetime goroutine, and the counts are exact - no precision
+// loss from parsing "4.56M"-style abbreviated text.
+//
+// Built only with `-tags libzfs`, since it needs libzfs-devel headers this
+// sandbox doesn't have. The default build stays shell-only; init below
+// only takes over as defaultCollector if /dev/zfs is actually reachable,
+// so a libzfs-tagged binary still runs fine on a host without the kernel
+// module loaded.
+
+import (
+	"fmt"
+	"time"
+
+	libzfs "github.com/bicomsystems/go-libzfs"
+)
+
+func init() {
+	if c, ok := newLibzfsCollector(); ok {
+		defaultCollector = c
+	}
+}
+
+// libzfsCollector reads vdev stats directly via libzfs. It holds no state;
+// StreamInterval keeps the last cumulative snapshot per device in a local
+// so it can report deltas the same way the shell collector's "interval"
+// rows do, even though the kernel itself only hands back a running total.
+type libzfsCollector struct{}
+
+func newLibzfsCollector() (Collector, bool) {
+	pool, err := libzfs.PoolOpenAll()
+	if err != nil || len(pool) == 0 {
+		// No pools visible, or /dev/zfs isn't reachable (module unloaded,
+		// no permission, etc.) - fall back to the shell collector.
+		return nil, false
+	}
+	for _, p := range pool {
+		p.Close()
+	}
+	return libzfsCollector{}, true
+}
+
+// FetchLifetime reads the current cumulative vdev_histo_* arrays for every
+// leaf vdev in pool, with no diffing - this already is the lifetime view.
+func (libzfsCollector) FetchLifetime(pool string) (map[string]*DeviceHistogram, error) {
+	p, err := libzfs.PoolOpen(pool)
+	if err != nil {
+		return nil, fmt.Errorf("opening pool %s: %w", pool, err)
+	}
+	defer p.Close()
+
+	root, err := p.VDevTree()
+	if err != nil {
+		return nil, fmt.Errorf("reading vdev tree: %w", err)
+	}
+
+	hists := make(map[string]*DeviceHistogram)
+	collectLeafHistograms(&root, hists)
+	return hists, nil
+}
+
+// StreamInterval polls FetchLifetime every interval and emits the
+// element-wise delta against the previous poll, so callers see the same
+// "this interval only" semantics the shell collector's streaming parse
+// produces - just without needing a second zpool process or being capped
+// at a 10-second granularity.
+func (lc libzfsCollector) StreamInterval(pool string, interval time.Duration, fn func(map[string]*DeviceHistogram), done <-chan struct{}) error {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	var prev map[string]*DeviceHistogram
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return nil
+		case <-ticker.C:
+			cur, err := lc.FetchLifetime(pool)
+			if err != nil {
+				continue
+			}
+			if prev != nil {
+				fn(diffHistograms(prev, cur))
+			}
+			prev = cur
+		}
+	}
+}
+
+// collectLeafHistograms walks a vdev tree, recording one DeviceHistogram
+// per leaf (disk) vdev keyed by its path/name, matching how the shell
+// collector keys histograms by the device name zpool iostat prints.
+func collectLeafHistograms(vdev *libzfs.VDevTree, out map[string]*DeviceHistogram) {
+	if len(vdev.Devices) == 0 {
+		hist := &DeviceHistogram{Name: vdev.Name}
+		populateFromVDevStats(hist, vdev.Stat)
+		out[vdev.Name] = hist
+		return
+	}
+	for i := range vdev.Devices {
+		collectLeafHistograms(&vdev.Devices[i], out)
+	}
+}
+
+// populateFromVDevStats copies the kernel's wait_queue and asyncq_wait
+// histograms into hist's total/disk/sync/async columns - the same column
+// layout parseZpoolOutput fills from zpool iostat -wvv's text table, so
+// every reader downstream (Display, the Prometheus exporter, -log) is
+// unaffected by which Collector produced the data.
+func populateFromVDevStats(hist *DeviceHistogram, stat libzfs.VDevStat) {
+	for i := 0; i < 37 && i < len(stat.ReadHisto); i++ {
+		hist.Buckets[i][colTotalRead] = stat.ReadHisto[i]
+		hist.Buckets[i][colTotalWrite] = stat.WriteHisto[i]
+		hist.Buckets[i][colDiskRead] = stat.DiskReadHisto[i]
+		hist.Buckets[i][colDiskWrite] = stat.DiskWriteHisto[i]
+		hist.Buckets[i][colSyncRead] = stat.SyncReadHisto[i]
+		hist.Buckets[i][colSyncWrite] = stat.SyncWriteHisto[i]
+		hist.Buckets[i][colAsyncRead] = stat.AsyncReadHisto[i]
+		hist.Buckets[i][colAsyncWrite] = stat.AsyncWriteHisto[i]
+		hist.Buckets[i][colScrub] = stat.ScrubHisto[i]
+		hist.Buckets[i][colTrim] = stat.TrimHisto[i]
+		hist.Buckets[i][colRebuild] = stat.RebuildHisto[i]
+	}
+}
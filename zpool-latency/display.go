@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// formatLatency formats a latency value (in µs) to human-readable string
+func formatLatency(us float64) string {
+	if us < 1 {
+		ns := us * 1000
+		return fmt.Sprintf("%dns", int(ns+0.5))
+	}
+	if us < 1000 {
+		return fmt.Sprintf("%dµs", int(us+0.5))
+	}
+	if us < 1_000_000 {
+		ms := us / 1000
+		if ms < 10 {
+			return fmt.Sprintf("%.1fms", ms)
+		}
+		return fmt.Sprintf("%dms", int(ms+0.5))
+	}
+	s := us / 1_000_000
+	return fmt.Sprintf("%.1fs", s)
+}
+
+func formatCount(n uint64) string {
+	if n >= 1_000_000_000 {
+		return fmt.Sprintf("%.1fB", float64(n)/1_000_000_000)
+	}
+	if n >= 1_000_000 {
+		return fmt.Sprintf("%.1fM", float64(n)/1_000_000)
+	}
+	if n >= 1_000 {
+		return fmt.Sprintf("%.1fK", float64(n)/1_000)
+	}
+	return fmt.Sprintf("%d", n)
+}
+
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%.0fs", d.Seconds())
+	}
+	if d < time.Hour {
+		m := int(d.Minutes())
+		s := int(d.Seconds()) % 60
+		return fmt.Sprintf("%dm%ds", m, s)
+	}
+	h := int(d.Hours())
+	m := int(d.Minutes()) % 60
+	return fmt.Sprintf("%dh%dm", h, m)
+}
+
+// Display handles rendering
+type Display struct {
+	batchMode bool
+	showDisk  bool
+	startTime time.Time
+}
+
+func (d *Display) resetCursor() {
+	if !d.batchMode {
+		fmt.Print("\033[H\033[J")
+	}
+}
+
+// shortenDeviceName returns a more readable short version of the device name
+func shortenDeviceName(name string) string {
+	// USB Seagate drives: extract just the serial
+	if strings.HasPrefix(name, "usb-Seagate_Expansion_HDD_") {
+		parts := strings.Split(name, "_")
+		if len(parts) >= 4 {
+			serial := parts[3]
+			if idx := strings.Index(serial, "-0:"); idx > 0 {
+				serial = serial[:idx]
+				if len(serial) > 8 {
+					serial = serial[len(serial)-8:]
+				}
+				return "usb:" + serial
+			}
+		}
+	}
+	// NVMe drives: shorten model name
+	if strings.HasPrefix(name, "nvme-") {
+		short := strings.TrimPrefix(name, "nvme-")
+		partSuffix := ""
+		if idx := strings.LastIndex(short, "-part"); idx > 0 {
+			partSuffix = short[idx:]
+			short = short[:idx]
+		}
+		parts := strings.Split(short, "_")
+		if len(parts) >= 2 {
+			serial := parts[len(parts)-1]
+			if len(serial) > 8 {
+				serial = serial[len(serial)-8:]
+			}
+			return "nvme:" + serial + partSuffix
+		}
+	}
+	// WWN drives: use partition number
+	if strings.HasPrefix(name, "wwn-") {
+		if idx := strings.LastIndex(name, "-part"); idx > 0 {
+			return "wwn" + name[idx:]
+		}
+	}
+	return name
+}
+
+// deviceSortKey returns a sortable key for devices
+func deviceSortKey(name string) string {
+	if !strings.Contains(name, "-") && !strings.HasPrefix(name, "draid") &&
+		!strings.HasPrefix(name, "mirror") && !strings.HasPrefix(name, "raidz") {
+		return "0_" + name
+	}
+	if strings.HasPrefix(name, "draid") || strings.HasPrefix(name, "mirror") ||
+		strings.HasPrefix(name, "raidz") {
+		return "1_" + name
+	}
+	if strings.HasPrefix(name, "nvme-") {
+		return "2_" + name
+	}
+	if strings.HasPrefix(name, "wwn-") {
+		return "3_" + name
+	}
+	if strings.HasPrefix(name, "usb-") {
+		return "4_" + name
+	}
+	return "5_" + name
+}
+
+// getSortedDevices returns device names sorted consistently
+func getSortedDevices(histograms map[string]*DeviceHistogram) []string {
+	var devList []string
+	for name := range histograms {
+		devList = append(devList, name)
+	}
+	sort.Slice(devList, func(i, j int) bool {
+		return deviceSortKey(devList[i]) < deviceSortKey(devList[j])
+	})
+	return devList
+}
+
+func (d *Display) render(intervalHist map[string]*DeviceHistogram, intervalUpdate time.Time, intervalCount uint64,
+	lifetimeHist map[string]*DeviceHistogram, lifetimeUpdate time.Time, intervalSec int) {
+	var buf strings.Builder
+	now := time.Now()
+
+	// Use lifetime devices as the canonical list (more complete)
+	devList := getSortedDevices(lifetimeHist)
+	if len(devList) == 0 {
+		devList = getSortedDevices(intervalHist)
+	}
+
+	timestamp := now.Format("15:04:05")
+	elapsed := now.Sub(d.startTime)
+	sinceInterval := now.Sub(intervalUpdate)
+	sinceLifetime := now.Sub(lifetimeUpdate)
+
+	fmt.Fprintf(&buf, "ZFS Pool Latency Monitor - %s (uptime: %s, interval: %ds)\n",
+		timestamp, formatDuration(elapsed), intervalSec)
+
+	lineWidth := 145
+	buf.WriteString(strings.Repeat("=", lineWidth))
+	buf.WriteString("\n")
+
+	waitLabel := "TOTAL_WAIT"
+	if d.showDisk {
+		waitLabel = "DISK_WAIT"
+	}
+
+	// INTERVAL SECTION
+	fmt.Fprintf(&buf, "INTERVAL (%s ago)    │          %s READ                      │          %s WRITE                     │  samples\n",
+		formatDuration(sinceInterval), waitLabel, waitLabel)
+	fmt.Fprintf(&buf, "%-20s │ %7s %7s %7s %7s %7s %7s │ %7s %7s %7s %7s %7s %7s │\n",
+		"", "avg", "p50", "p90", "p99", "p99.9", "max",
+		"avg", "p50", "p90", "p99", "p99.9", "max")
+	buf.WriteString(strings.Repeat("-", lineWidth))
+	buf.WriteString("\n")
+
+	for _, name := range devList {
+		hist := intervalHist[name]
+		if hist == nil {
+			hist = &DeviceHistogram{Name: name}
+		}
+		d.renderDevice(&buf, name, hist)
+	}
+
+	buf.WriteString("\n")
+
+	// LIFETIME SECTION
+	fmt.Fprintf(&buf, "LIFETIME (%s ago)    │          %s READ                      │          %s WRITE                     │  samples\n",
+		formatDuration(sinceLifetime), waitLabel, waitLabel)
+	fmt.Fprintf(&buf, "%-20s │ %7s %7s %7s %7s %7s %7s │ %7s %7s %7s %7s %7s %7s │\n",
+		"", "avg", "p50", "p90", "p99", "p99.9", "max",
+		"avg", "p50", "p90", "p99", "p99.9", "max")
+	buf.WriteString(strings.Repeat("-", lineWidth))
+	buf.WriteString("\n")
+
+	for _, name := range devList {
+		hist := lifetimeHist[name]
+		if hist == nil {
+			hist = &DeviceHistogram{Name: name}
+		}
+		d.renderDevice(&buf, name, hist)
+	}
+
+	buf.WriteString(strings.Repeat("=", lineWidth))
+	buf.WriteString("\n")
+
+	// Stats summary
+	var totalSamples uint64
+	for _, h := range lifetimeHist {
+		for i := 0; i < 37; i++ {
+			totalSamples += h.Buckets[i][colTotalRead] + h.Buckets[i][colTotalWrite]
+		}
+	}
+	modeHint := "total_wait = queue + disk"
+	if d.showDisk {
+		modeHint = "disk_wait = disk only"
+	}
+	fmt.Fprintf(&buf, "Total I/O: %s | Interval updates: %d | %s\n",
+		formatCount(totalSamples), intervalCount, modeHint)
+
+	if d.batchMode {
+		buf.WriteString("\n")
+	}
+
+	d.resetCursor()
+	fmt.Print(buf.String())
+}
+
+func (d *Display) renderDevice(buf *strings.Builder, name string, hist *DeviceHistogram) {
+	readCol, writeCol := colTotalRead, colTotalWrite
+	if d.showDisk {
+		readCol, writeCol = colDiskRead, colDiskWrite
+	}
+
+	readHist := newHistogramFromBuckets(deviceColumn(hist, readCol))
+	writeHist := newHistogramFromBuckets(deviceColumn(hist, writeCol))
+
+	displayName := shortenDeviceName(name)
+	if len(displayName) > 20 {
+		displayName = displayName[:17] + "..."
+	}
+
+	totalOps := readHist.TotalCount() + writeHist.TotalCount()
+
+	if readHist.TotalCount() == 0 && writeHist.TotalCount() == 0 {
+		fmt.Fprintf(buf, "%-20s │ %7s %7s %7s %7s %7s %7s │ %7s %7s %7s %7s %7s %7s │ %8s\n",
+			displayName, "-", "-", "-", "-", "-", "-", "-", "-", "-", "-", "-", "-", "0")
+		return
+	}
+
+	fmtLat := func(us float64) string { return fmt.Sprintf("%7s", formatLatency(us)) }
+
+	readAvg, readP50, readP90, readP99, readP999, readMax := "      -", "      -", "      -", "      -", "      -", "      -"
+	if readHist.TotalCount() > 0 {
+		readAvg = fmtLat(readHist.Mean())
+		readP50 = fmtLat(readHist.Percentile(50))
+		readP90 = fmtLat(readHist.Percentile(90))
+		readP99 = fmtLat(readHist.Percentile(99))
+		readP999 = fmtLat(readHist.Percentile(99.9))
+		readMax = fmtLat(readHist.Max())
+	}
+
+	writeAvg, writeP50, writeP90, writeP99, writeP999, writeMax := "      -", "      -", "      -", "      -", "      -", "      -"
+	if writeHist.TotalCount() > 0 {
+		writeAvg = fmtLat(writeHist.Mean())
+		writeP50 = fmtLat(writeHist.Percentile(50))
+		writeP90 = fmtLat(writeHist.Percentile(90))
+		writeP99 = fmtLat(writeHist.Percentile(99))
+		writeP999 = fmtLat(writeHist.Percentile(99.9))
+		writeMax = fmtLat(writeHist.Max())
+	}
+
+	fmt.Fprintf(buf, "%-20s │ %s %s %s %s %s %s │ %s %s %s %s %s %s │ %8s\n",
+		displayName,
+		readAvg, readP50, readP90, readP99, readP999, readMax,
+		writeAvg, writeP50, writeP90, writeP99, writeP999, writeMax,
+		formatCount(totalOps))
+}
@@ -0,0 +1,203 @@
+package main
+
+// heatmap.go: `-heatmap` mode (chunk5-5). Replaces the percentile table
+// with a scrolling time x bucket heatmap for one device at a time: rows
+// are the 37 latency buckets, columns are the last historyDepth interval
+// snapshots (State.History), and cell color encodes that column's share
+// of its own total. A multimodal distribution - a fast majority plus a
+// slow tail - shows up as two bright bands instead of being averaged away
+// into one percentile number, which is the standard way `zpool iostat -w`
+// output gets visualized in analysis writeups.
+//
+// heatmapController owns the device-cycling keystroke loop, the same
+// raw-mode-stdin pattern top_txg.go's App.run uses.
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// historyDepth is how many past interval snapshots State keeps (and the
+// heatmap draws) per device.
+const historyDepth = 80
+
+// historySample is one interval snapshot recorded for the heatmap.
+type historySample struct {
+	timestamp time.Time
+	hist      *DeviceHistogram
+}
+
+// heatmapController renders one device's latency heatmap at a time,
+// cyclable with 'n'/'p' and exitable with 'q'.
+type heatmapController struct {
+	intervalState *State
+	lifetimeState *State
+	showDisk      bool
+	selected      int
+}
+
+func newHeatmapController(intervalState, lifetimeState *State, showDisk bool) *heatmapController {
+	return &heatmapController{intervalState: intervalState, lifetimeState: lifetimeState, showDisk: showDisk}
+}
+
+// Run sets the terminal to raw mode, reads single-byte keystrokes in the
+// background, and redraws on whichever comes first: a keystroke, the
+// display ticker, or done closing.
+func (hc *heatmapController) Run(done <-chan struct{}) {
+	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		log.Printf("heatmap: failed to set raw mode (%v), device cycling via n/p will not work", err)
+	} else {
+		defer term.Restore(int(os.Stdin.Fd()), oldState)
+	}
+
+	fmt.Print("\033[?25l")
+	defer fmt.Print("\033[?25h")
+
+	keyCh := make(chan byte, 10)
+	go func() {
+		buf := make([]byte, 1)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil || n == 0 {
+				return
+			}
+			keyCh <- buf[0]
+		}
+	}()
+
+	ticker := time.NewTicker(displayInterval)
+	defer ticker.Stop()
+
+	hc.render()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			hc.render()
+		case key := <-keyCh:
+			switch key {
+			case 'q', 'Q', 3: // 3 = Ctrl-C
+				return
+			case 'n', 'N':
+				hc.next()
+			case 'p', 'P':
+				hc.prev()
+			}
+			hc.render()
+		}
+	}
+}
+
+func (hc *heatmapController) devices() []string {
+	hist, _, _ := hc.lifetimeState.Snapshot()
+	return getSortedDevices(hist)
+}
+
+func (hc *heatmapController) next() { hc.selected++ }
+
+func (hc *heatmapController) prev() {
+	if hc.selected > 0 {
+		hc.selected--
+	}
+}
+
+func (hc *heatmapController) render() {
+	devs := hc.devices()
+	fmt.Print("\033[H\033[J")
+	if len(devs) == 0 {
+		fmt.Println("ZFS Pool Latency Heatmap - waiting for device data...")
+		return
+	}
+	if hc.selected >= len(devs) {
+		hc.selected = len(devs) - 1
+	}
+	if hc.selected < 0 {
+		hc.selected = 0
+	}
+	dev := devs[hc.selected]
+	samples := hc.intervalState.History(dev)
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "ZFS Pool Latency Heatmap - device %d/%d (n/p: cycle device, q: quit)\n",
+		hc.selected+1, len(devs))
+	renderHeatmap(&buf, dev, samples, hc.showDisk)
+	fmt.Print(buf.String())
+}
+
+// renderHeatmap draws dev's recorded snapshots as a 37-row x
+// len(samples)-column grid (slowest bucket on top), one cell per
+// snapshot per bucket, colored by that bucket's share of its own
+// snapshot's total.
+func renderHeatmap(buf *strings.Builder, dev string, samples []historySample, showDisk bool) {
+	readCol, writeCol := colTotalRead, colTotalWrite
+	if showDisk {
+		readCol, writeCol = colDiskRead, colDiskWrite
+	}
+
+	fmt.Fprintf(buf, "%s (%d samples)\n", shortenDeviceName(dev), len(samples))
+
+	if len(samples) == 0 {
+		buf.WriteString("(no interval history yet)\n")
+		return
+	}
+
+	columnTotals := make([]uint64, len(samples))
+	for c, s := range samples {
+		for i := 0; i < 37; i++ {
+			columnTotals[c] += s.hist.Buckets[i][readCol] + s.hist.Buckets[i][writeCol]
+		}
+	}
+
+	for row := 36; row >= 0; row-- {
+		fmt.Fprintf(buf, "%8s ", formatLatency(bucketMidpointsUs[row]))
+		for c, s := range samples {
+			count := s.hist.Buckets[row][readCol] + s.hist.Buckets[row][writeCol]
+			buf.WriteString(heatCell(count, columnTotals[c]))
+		}
+		buf.WriteString("\033[0m\n")
+	}
+}
+
+// heatCell renders one grid cell as two spaces with a 24-bit ANSI
+// background color; intensity is count's share of colTotal, so the
+// densest bucket in any given interval stands out regardless of how busy
+// that interval was overall.
+func heatCell(count, colTotal uint64) string {
+	if colTotal == 0 || count == 0 {
+		return "\033[48;2;20;20;30m  "
+	}
+	frac := float64(count) / float64(colTotal)
+	r, g, b := heatColor(frac)
+	return fmt.Sprintf("\033[48;2;%d;%d;%dm  ", r, g, b)
+}
+
+// heatColor maps frac in [0,1] along a dark-blue -> cyan -> yellow -> red
+// gradient, so low-density cells stay unobtrusive and the hottest cells
+// in any column pop.
+func heatColor(frac float64) (r, g, b int) {
+	if frac > 1 {
+		frac = 1
+	}
+	switch {
+	case frac < 0.33:
+		t := frac / 0.33
+		return lerp(20, 0, t), lerp(20, 120, t), lerp(120, 160, t)
+	case frac < 0.66:
+		t := (frac - 0.33) / 0.33
+		return lerp(0, 230, t), lerp(120, 210, t), lerp(160, 40, t)
+	default:
+		t := (frac - 0.66) / 0.34
+		return lerp(230, 220, t), lerp(210, 40, t), lerp(40, 30, t)
+	}
+}
+
+func lerp(a, b int, t float64) int {
+	return int(float64(a) + t*float64(b-a))
+}
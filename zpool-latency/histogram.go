@@ -0,0 +1,165 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Latency bucket definitions (nanoseconds)
+// These are the exact bucket labels from zpool iostat -wvv
+var bucketLabels = []string{
+	"1ns", "3ns", "7ns", "15ns", "31ns", "63ns", "127ns", "255ns", "511ns",
+	"1us", "2us", "4us", "8us", "16us", "32us", "65us", "131us", "262us", "524us",
+	"1ms", "2ms", "4ms", "8ms", "16ms", "33ms", "67ms", "134ms", "268ms", "536ms",
+	"1s", "2s", "4s", "8s", "17s", "34s", "68s", "137s",
+}
+
+// Bucket midpoints in microseconds (for percentile calculation)
+var bucketMidpointsUs = []float64{
+	0.001, 0.003, 0.007, 0.015, 0.031, 0.063, 0.127, 0.255, 0.511,
+	1, 2, 4, 8, 16, 32, 65, 131, 262, 524,
+	1000, 2000, 4000, 8000, 16000, 33000, 67000, 134000, 268000, 536000,
+	1000000, 2000000, 4000000, 8000000, 17000000, 34000000, 68000000, 137000000,
+}
+
+// Column indices in the histogram data
+const (
+	colTotalRead  = 0
+	colTotalWrite = 1
+	colDiskRead   = 2
+	colDiskWrite  = 3
+	colSyncRead   = 4
+	colSyncWrite  = 5
+	colAsyncRead  = 6
+	colAsyncWrite = 7
+	colScrub      = 8
+	colTrim       = 9
+	colRebuild    = 10
+	numColumns    = 11
+)
+
+// DeviceHistogram holds histogram data for one device
+type DeviceHistogram struct {
+	Name    string
+	Buckets [37][11]uint64 // 37 latency buckets × 11 columns
+}
+
+// parseCount parses a count value like "1.23K", "4.56M", or plain number
+func parseCount(s string) uint64 {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "-" {
+		return 0
+	}
+
+	multiplier := 1.0
+	if strings.HasSuffix(s, "K") {
+		multiplier = 1000
+		s = s[:len(s)-1]
+	} else if strings.HasSuffix(s, "M") {
+		multiplier = 1000000
+		s = s[:len(s)-1]
+	} else if strings.HasSuffix(s, "B") {
+		multiplier = 1000000000
+		s = s[:len(s)-1]
+	}
+
+	val, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return uint64(val * multiplier)
+}
+
+// Histogram provides percentile calculations from bucket counts
+type Histogram struct {
+	counts []uint64
+	total  uint64
+}
+
+func newHistogramFromBuckets(buckets []uint64) *Histogram {
+	h := &Histogram{counts: make([]uint64, len(buckets))}
+	copy(h.counts, buckets)
+	for _, c := range buckets {
+		h.total += c
+	}
+	return h
+}
+
+func (h *Histogram) TotalCount() uint64 {
+	return h.total
+}
+
+func (h *Histogram) Mean() float64 {
+	if h.total == 0 {
+		return 0
+	}
+	sum := 0.0
+	for i, c := range h.counts {
+		sum += float64(c) * bucketMidpointsUs[i]
+	}
+	return sum / float64(h.total)
+}
+
+func (h *Histogram) Percentile(p float64) float64 {
+	if h.total == 0 {
+		return 0
+	}
+	target := uint64(float64(h.total) * p / 100.0)
+	if target == 0 {
+		target = 1
+	}
+
+	cumulative := uint64(0)
+	for i, c := range h.counts {
+		cumulative += c
+		if cumulative >= target {
+			return bucketMidpointsUs[i]
+		}
+	}
+	return bucketMidpointsUs[len(bucketMidpointsUs)-1]
+}
+
+func (h *Histogram) Max() float64 {
+	for i := len(h.counts) - 1; i >= 0; i-- {
+		if h.counts[i] > 0 {
+			return bucketMidpointsUs[i]
+		}
+	}
+	return 0
+}
+
+// deviceColumn extracts one column across all 37 buckets for hist.
+func deviceColumn(hist *DeviceHistogram, col int) []uint64 {
+	buckets := make([]uint64, 37)
+	for i := 0; i < 37; i++ {
+		buckets[i] = hist.Buckets[i][col]
+	}
+	return buckets
+}
+
+// diffHistograms returns cur minus prev, bucket by bucket, clamped to zero
+// wherever a counter went backwards (device replaced, stats reset) rather
+// than underflowing - the same defensive pattern backups/iostat.go uses
+// for its /sys/block counters. A device present in cur but not prev (new
+// device, or first snapshot ever) is passed through unchanged, since
+// there's nothing to subtract.
+func diffHistograms(prev, cur map[string]*DeviceHistogram) map[string]*DeviceHistogram {
+	out := make(map[string]*DeviceHistogram, len(cur))
+	for dev, curHist := range cur {
+		delta := &DeviceHistogram{Name: dev}
+		prevHist, ok := prev[dev]
+		for i := 0; i < 37; i++ {
+			for c := 0; c < numColumns; c++ {
+				var p uint64
+				if ok {
+					p = prevHist.Buckets[i][c]
+				}
+				if curHist.Buckets[i][c] >= p {
+					delta.Buckets[i][c] = curHist.Buckets[i][c] - p
+				}
+			}
+		}
+		out[dev] = delta
+	}
+	return out
+}
@@ -0,0 +1,125 @@
+package main
+
+// log.go: `-log <file>` recording and the snapshot record format replayed
+// by `-replay <file>` (chunk5-2). Records are newline-delimited JSON so a
+// log can be tailed or reprocessed with ordinary text tools, matching the
+// JSON convention blk-latency's own state.go already uses for persistence.
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// snapshotRecord is one logged interval snapshot: a timestamp, the pool it
+// was collected from, and the full per-device 37x11 bucket matrix.
+type snapshotRecord struct {
+	Timestamp time.Time                   `json:"timestamp"`
+	Pool      string                      `json:"pool"`
+	Devices   map[string]*DeviceHistogram `json:"devices"`
+}
+
+// logWriter appends snapshotRecords to a file as newline-delimited JSON.
+type logWriter struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+func openLogWriter(path string) (*logWriter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("opening log file: %w", err)
+	}
+	return &logWriter{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+func (lw *logWriter) WriteSnapshot(pool string, devices map[string]*DeviceHistogram) error {
+	rec := snapshotRecord{Timestamp: time.Now(), Pool: pool, Devices: devices}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := lw.w.Write(data); err != nil {
+		return err
+	}
+	if err := lw.w.WriteByte('\n'); err != nil {
+		return err
+	}
+	return lw.w.Flush()
+}
+
+func (lw *logWriter) Close() error {
+	if err := lw.w.Flush(); err != nil {
+		lw.f.Close()
+		return err
+	}
+	return lw.f.Close()
+}
+
+// readLogFile loads every snapshotRecord from path, in the order recorded.
+func readLogFile(path string) ([]snapshotRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening log file: %w", err)
+	}
+	defer f.Close()
+
+	var records []snapshotRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var rec snapshotRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return nil, fmt.Errorf("parsing record: %w", err)
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("reading log file: %w", err)
+	}
+	return records, nil
+}
+
+// addHistogram adds src's bucket counts into dst element-wise, so a run of
+// recorded interval (delta) snapshots can be folded into a running
+// cumulative "lifetime" total during replay.
+func addHistogram(dst, src *DeviceHistogram) {
+	for i := 0; i < 37; i++ {
+		for c := 0; c < numColumns; c++ {
+			dst.Buckets[i][c] += src.Buckets[i][c]
+		}
+	}
+}
+
+// runLogger watches state for new snapshots (by updateCount) and appends
+// each one to w, so -log stays source-agnostic: it works the same whether
+// state is fed by a live zpool process or anything else implementing
+// Source.
+func runLogger(state *State, pool string, w *logWriter, done <-chan struct{}) {
+	defer w.Close()
+	lastCount := uint64(0)
+	ticker := time.NewTicker(displayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			hist, _, count := state.Snapshot()
+			if count == lastCount || count == 0 {
+				continue
+			}
+			lastCount = count
+			if err := w.WriteSnapshot(pool, hist); err != nil {
+				fmt.Fprintf(os.Stderr, "log: failed to write snapshot: %v\n", err)
+			}
+		}
+	}
+}
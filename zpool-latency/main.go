@@ -0,0 +1,184 @@
+// zpool-latency: Real-time ZFS pool latency histogram viewer
+//
+// Parses zpool iostat -wvv output and displays per-device latency percentiles
+// in a real-time updating view similar to blk-latency.
+//
+// Architecture:
+//   - Interval stats: streaming from `zpool iostat -wvv pool <interval>`
+//   - Lifetime stats: periodic exec of `zpool iostat -wvv pool` (cumulative)
+//   - Optional -listen exposes both as an OpenMetrics /metrics endpoint
+//     (see prometheus.go) so a fleet can be scraped instead of watched.
+//   - Optional -log records every interval snapshot to disk (see log.go);
+//     -replay plays one of those files back through the same Display,
+//     with no zpool process involved (see source.go's Source interface).
+//
+// Usage: go run ./zpool-latency [pool] [-i interval]
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	displayInterval  = 100 * time.Millisecond // 10 FPS display refresh
+	lifetimePollFreq = 2 * time.Second        // How often to fetch lifetime stats
+)
+
+var (
+	poolName       = flag.String("pool", "", "ZFS pool name (required, or as first positional arg, unless -replay is set)")
+	interval       = flag.Int("i", 10, "zpool iostat interval in seconds")
+	batch          = flag.Bool("batch", false, "batch mode (no screen clearing)")
+	showDisk       = flag.Bool("disk", false, "show disk_wait instead of total_wait")
+	listenAddr     = flag.String("listen", "", "address to serve an OpenMetrics /metrics endpoint on (e.g. :9105); empty disables it")
+	logPath        = flag.String("log", "", "append every interval snapshot to this file as newline-delimited JSON")
+	replayPath     = flag.String("replay", "", "replay interval snapshots from a -log file instead of running zpool")
+	replaySpeed    = flag.Float64("speed", 1.0, "replay speed multiplier (only with -replay); <=0 replays as fast as possible")
+	deriveInterval = flag.Bool("derive-interval", false, "compute interval stats from consecutive lifetime polls instead of a second zpool iostat stream; -i becomes the poll period")
+	heatmap        = flag.Bool("heatmap", false, "interactive scrolling time x bucket heatmap for one device at a time (n/p to cycle, q to quit)")
+	onAlert        = flag.String("on-alert", "", "hook run on every --alert fire/resolve: exec:<cmdline with %device/%metric/%value> or webhook:<url>")
+	dryRunAlerts   = flag.Bool("dry-run", false, "log what --alert would fire/resolve instead of running -on-alert")
+)
+
+func main() {
+	var alertRules alertRuleList
+	flag.Var(&alertRules, "alert", "\"pNN(read|write,total|disk|sync|async) > DURATION for N intervals\" latency SLO (repeatable)")
+
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: zpool-latency [-i interval] [-batch] [-disk] [-listen addr] [-log file] <pool>")
+		fmt.Fprintln(os.Stderr, "       zpool-latency -replay file [-speed N] [-batch] [-disk]")
+		fmt.Fprintln(os.Stderr, "  pool:    ZFS pool name (required unless -replay is set)")
+		fmt.Fprintln(os.Stderr, "  -i:      zpool iostat interval in seconds (default: 10)")
+		fmt.Fprintln(os.Stderr, "  -batch:  batch mode, no screen clearing")
+		fmt.Fprintln(os.Stderr, "  -disk:   show disk_wait instead of total_wait")
+		fmt.Fprintln(os.Stderr, "  -listen: serve an OpenMetrics /metrics endpoint (e.g. :9105)")
+		fmt.Fprintln(os.Stderr, "  -log:    record every interval snapshot to file")
+		fmt.Fprintln(os.Stderr, "  -replay: replay snapshots from a -log file instead of running zpool")
+		fmt.Fprintln(os.Stderr, "  -speed:  replay speed multiplier (default: 1.0)")
+		fmt.Fprintln(os.Stderr, "  -derive-interval: derive interval stats from lifetime polls, skipping the second zpool iostat stream")
+		fmt.Fprintln(os.Stderr, "  -heatmap: interactive time x bucket heatmap for one device at a time (n/p to cycle, q to quit)")
+		fmt.Fprintln(os.Stderr, "  -alert:   \"pNN(read|write,total|disk|sync|async) > DURATION for N intervals\" (repeatable)")
+		fmt.Fprintln(os.Stderr, "  -on-alert: exec:<cmdline with %device/%metric/%value> or webhook:<url>")
+		fmt.Fprintln(os.Stderr, "  -dry-run: log what -alert would fire/resolve instead of running -on-alert")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Wait types:")
+		fmt.Fprintln(os.Stderr, "  total_wait = time in queue + disk service time")
+		fmt.Fprintln(os.Stderr, "  disk_wait  = actual disk service time only")
+	}
+	flag.Parse()
+
+	pool := *poolName
+	if pool == "" && flag.NArg() > 0 {
+		pool = flag.Arg(0)
+	}
+	if pool == "" && *replayPath == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	intervalState := newState()
+	lifetimeState := newState()
+	display := &Display{batchMode: *batch, showDisk: *showDisk, startTime: time.Now()}
+
+	if *listenAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", &promCollector{lifetime: lifetimeState, interval: intervalState})
+		go func() {
+			log.Printf("Serving OpenMetrics /metrics on %s", *listenAddr)
+			if err := http.ListenAndServe(*listenAddr, mux); err != nil {
+				log.Printf("HTTP server stopped: %v", err)
+			}
+		}()
+	}
+
+	// Signal handling
+	done := make(chan struct{})
+	var stopOnce sync.Once
+	stop := func() { stopOnce.Do(func() { close(done) }) }
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		<-sig
+		stop()
+	}()
+
+	var source Source
+	if *replayPath != "" {
+		source = newReplaySource(*replayPath, *replaySpeed, intervalState, lifetimeState)
+	} else {
+		source = newLiveSource(pool, time.Duration(*interval)*time.Second, *deriveInterval, intervalState, lifetimeState)
+
+		if !*batch {
+			fmt.Printf("Starting zpool iostat on pool '%s' (interval: %ds)...\n", pool, *interval)
+			fmt.Println("Waiting for first data snapshot...")
+		}
+
+		if *logPath != "" {
+			logWriter, err := openLogWriter(*logPath)
+			if err != nil {
+				log.Fatalf("Failed to open -log file: %v", err)
+			}
+			go runLogger(intervalState, pool, logWriter, done)
+		}
+	}
+
+	if *heatmap {
+		intervalState.EnableHistory()
+	}
+
+	if len(alertRules) > 0 {
+		go runAlertEvaluator(intervalState, alertRules, *onAlert, *dryRunAlerts, done)
+	}
+
+	sourceFinished := make(chan struct{})
+	go source.Run(done, sourceFinished)
+
+	if *heatmap {
+		hc := newHeatmapController(intervalState, lifetimeState, *showDisk)
+		go func() {
+			hc.Run(done)
+			stop() // 'q' (or Ctrl-C, read as a key in raw mode) ends the program
+		}()
+	} else {
+		// Display goroutine (10 FPS)
+		displayTicker := time.NewTicker(displayInterval)
+		go func() {
+			defer displayTicker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-displayTicker.C:
+					intervalHist, intervalUpdate, intervalCount := intervalState.Snapshot()
+					lifetimeHist, lifetimeUpdate, _ := lifetimeState.Snapshot()
+
+					// Need at least lifetime stats to display
+					if len(lifetimeHist) > 0 {
+						display.render(intervalHist, intervalUpdate, intervalCount,
+							lifetimeHist, lifetimeUpdate, *interval)
+					}
+				}
+			}
+		}()
+	}
+
+	// Wait for shutdown, either from a signal or the source running dry.
+	select {
+	case <-done:
+	case <-sourceFinished:
+		stop()
+	}
+
+	if !*batch {
+		fmt.Println("\nStopped.")
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// bucketLabelIndex maps bucket labels to indices
+var bucketLabelIndex = make(map[string]int)
+
+func init() {
+	for i, label := range bucketLabels {
+		bucketLabelIndex[label] = i
+	}
+}
+
+var (
+	deviceHeaderPattern = regexp.MustCompile(`^(\S+)\s+total_wait`)
+	latencyLinePattern  = regexp.MustCompile(`^\s*(\d+(?:ns|us|ms|s))\s+(.+)`)
+	separatorPattern    = regexp.MustCompile(`^[-]+$`)
+)
+
+// parseZpoolOutput parses zpool iostat -wvv output from a reader
+func parseZpoolOutput(reader io.Reader) map[string]*DeviceHistogram {
+	scanner := bufio.NewScanner(reader)
+	histograms := make(map[string]*DeviceHistogram)
+	var currentDevice *DeviceHistogram
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if trimmed == "" || separatorPattern.MatchString(trimmed) {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "latency") {
+			continue
+		}
+
+		if strings.Contains(line, "total_wait") {
+			if matches := deviceHeaderPattern.FindStringSubmatch(line); matches != nil {
+				deviceName := matches[1]
+				currentDevice = &DeviceHistogram{Name: deviceName}
+				histograms[deviceName] = currentDevice
+			}
+			continue
+		}
+
+		if currentDevice != nil {
+			if matches := latencyLinePattern.FindStringSubmatch(line); matches != nil {
+				bucketLabel := matches[1]
+				valuesStr := matches[2]
+
+				bucketIdx, ok := bucketLabelIndex[bucketLabel]
+				if !ok {
+					continue
+				}
+
+				values := strings.Fields(valuesStr)
+				for col := 0; col < numColumns && col < len(values); col++ {
+					currentDevice.Buckets[bucketIdx][col] = parseCount(values[col])
+				}
+			}
+		}
+	}
+
+	return histograms
+}
+
+// IntervalParser parses streaming zpool iostat output for interval stats,
+// calling sink once per completed snapshot. sink is usually a State's
+// Update method, but shellCollector.StreamInterval passes through whatever
+// callback its caller gave it.
+type IntervalParser struct {
+	sink      func(map[string]*DeviceHistogram)
+	skipFirst bool // Skip first output (it's lifetime, not interval)
+	seenFirst bool
+}
+
+func newIntervalParser(sink func(map[string]*DeviceHistogram)) *IntervalParser {
+	return &IntervalParser{sink: sink, skipFirst: true}
+}
+
+func (p *IntervalParser) Parse(reader io.Reader) {
+	scanner := bufio.NewScanner(reader)
+	histograms := make(map[string]*DeviceHistogram)
+	var currentDevice *DeviceHistogram
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if trimmed == "" || separatorPattern.MatchString(trimmed) {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "latency") {
+			continue
+		}
+
+		if strings.Contains(line, "total_wait") {
+			if matches := deviceHeaderPattern.FindStringSubmatch(line); matches != nil {
+				deviceName := matches[1]
+
+				// Check if this is the start of a new interval
+				if _, exists := histograms[deviceName]; exists && len(histograms) > 0 {
+					// Completed one full snapshot
+					if p.skipFirst && !p.seenFirst {
+						// Skip the first snapshot (it's lifetime stats)
+						p.seenFirst = true
+					} else {
+						p.sink(histograms)
+					}
+					histograms = make(map[string]*DeviceHistogram)
+				}
+
+				currentDevice = &DeviceHistogram{Name: deviceName}
+				histograms[deviceName] = currentDevice
+			}
+			continue
+		}
+
+		if currentDevice != nil {
+			if matches := latencyLinePattern.FindStringSubmatch(line); matches != nil {
+				bucketLabel := matches[1]
+				valuesStr := matches[2]
+
+				bucketIdx, ok := bucketLabelIndex[bucketLabel]
+				if !ok {
+					continue
+				}
+
+				values := strings.Fields(valuesStr)
+				for col := 0; col < numColumns && col < len(values); col++ {
+					currentDevice.Buckets[bucketIdx][col] = parseCount(values[col])
+				}
+			}
+		}
+	}
+}
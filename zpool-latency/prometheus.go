@@ -0,0 +1,113 @@
+package main
+
+// prometheus.go: a -listen OpenMetrics exporter (chunk5-1), in the same
+// hand-rolled text-exposition style as blk-latency's own promCollector.
+// Cumulative lifetime histograms are exposed as native OpenMetrics
+// histograms - one series per device/wait_type/op, using the existing 37
+// bucket midpoints as `le` boundaries - plus a derived p50/p90/p99/p99.9
+// gauge family. A second, non-cumulative histogram family exposes the
+// current interval snapshot the same way, so a scraper can alert on both
+// "latency right now" and "latency over this process's whole lifetime".
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// waitOps pairs each exposed column with the wait_type/op labels it's
+// reported under; disk_wait mirrors total_wait but measures service time
+// only (see -disk in Display).
+var waitOps = []struct {
+	col      int
+	waitType string
+	op       string
+}{
+	{colTotalRead, "total", "read"},
+	{colTotalWrite, "total", "write"},
+	{colDiskRead, "disk", "read"},
+	{colDiskWrite, "disk", "write"},
+}
+
+// exportedQuantiles are the percentiles published in the _quantile_seconds
+// gauge family alongside each histogram.
+var exportedQuantiles = []struct {
+	label string
+	pct   float64
+}{
+	{"0.5", 50}, {"0.9", 90}, {"0.99", 99}, {"0.999", 99.9},
+}
+
+// promCollector renders both the lifetime and interval states as
+// Prometheus/OpenMetrics text exposition. It snapshots each State exactly
+// once per scrape - the same lock-free-after-copy pattern used by
+// blk-latency's own promCollector - then formats the response from the
+// copies.
+type promCollector struct {
+	lifetime *State
+	interval *State
+}
+
+func (pc *promCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	lifetimeHist, _, _ := pc.lifetime.Snapshot()
+	intervalHist, _, _ := pc.interval.Snapshot()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	writeHistogramFamily(w, "zfs_pool_latency_seconds",
+		"ZFS pool per-device latency, lifetime cumulative distribution.", lifetimeHist)
+	writeHistogramFamily(w, "zfs_pool_latency_interval_seconds",
+		"ZFS pool per-device latency, current interval only (non-cumulative).", intervalHist)
+}
+
+func writeHistogramFamily(w http.ResponseWriter, name, help string, hists map[string]*DeviceHistogram) {
+	devList := sortedDeviceNames(hists)
+
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	for _, dev := range devList {
+		hist := hists[dev]
+		for _, wo := range waitOps {
+			h := newHistogramFromBuckets(deviceColumn(hist, wo.col))
+			labels := fmt.Sprintf("device=%q,wait_type=%q,op=%q", dev, wo.waitType, wo.op)
+
+			cumulative := uint64(0)
+			for i := 0; i < 37; i++ {
+				cumulative += hist.Buckets[i][wo.col]
+				fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatSecondsUs(bucketMidpointsUs[i]), cumulative)
+			}
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.TotalCount())
+			fmt.Fprintf(w, "%s_sum{%s} %f\n", name, labels, h.Mean()*float64(h.TotalCount())/1_000_000)
+			fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.TotalCount())
+		}
+	}
+
+	fmt.Fprintf(w, "# HELP %s_quantile_seconds Derived percentiles from %s.\n", name, name)
+	fmt.Fprintf(w, "# TYPE %s_quantile_seconds gauge\n", name)
+	for _, dev := range devList {
+		hist := hists[dev]
+		for _, wo := range waitOps {
+			h := newHistogramFromBuckets(deviceColumn(hist, wo.col))
+			labels := fmt.Sprintf("device=%q,wait_type=%q,op=%q", dev, wo.waitType, wo.op)
+			for _, q := range exportedQuantiles {
+				fmt.Fprintf(w, "%s_quantile_seconds{%s,quantile=\"%s\"} %f\n", name, labels, q.label, h.Percentile(q.pct)/1_000_000)
+			}
+		}
+	}
+}
+
+func sortedDeviceNames(hists map[string]*DeviceHistogram) []string {
+	var devList []string
+	for dev := range hists {
+		devList = append(devList, dev)
+	}
+	sort.Strings(devList)
+	return devList
+}
+
+// formatSecondsUs renders a microsecond bucket bound as a Prometheus `le`
+// value in fractional seconds, matching blk-latency's own convention.
+func formatSecondsUs(us float64) string {
+	return strconv.FormatFloat(us/1_000_000, 'g', -1, 64)
+}
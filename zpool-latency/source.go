@@ -0,0 +1,151 @@
+package main
+
+// source.go: the Source interface that decouples the render path from
+// where interval/lifetime snapshots come from (chunk5-2). liveSource
+// drives intervalState/lifetimeState from a running `zpool iostat`
+// process, exactly as main() used to inline; replaySource drives them
+// from a -log file instead, so Display never needs to know which one is
+// in use.
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Source feeds snapshots into its State(s) until done is closed or it
+// runs out of data, then closes finished.
+type Source interface {
+	Run(done <-chan struct{}, finished chan<- struct{})
+}
+
+// liveSource drives intervalState/lifetimeState from a Collector (the
+// shell collector by default; see collector.go and, with -tags libzfs,
+// collector_libzfs.go), the same pair of responsibilities main() used to
+// start directly before chunk5-3 pulled the collection strategy out
+// behind an interface.
+//
+// deriveInterval (chunk5-4) replaces collector.StreamInterval's own
+// forked `zpool iostat <interval>` stream with cheaper element-wise
+// subtraction of consecutive lifetime polls (State.EnableDeltaDerivation):
+// one fewer process, and interval granularity is no longer bound by
+// zpool iostat's own streaming minimum - the lifetime poller itself runs
+// at interval instead of the fixed lifetimePollFreq.
+type liveSource struct {
+	pool           string
+	interval       time.Duration
+	deriveInterval bool
+	collector      Collector
+	intervalState  *State
+	lifetimeState  *State
+}
+
+func newLiveSource(pool string, interval time.Duration, deriveInterval bool, intervalState, lifetimeState *State) *liveSource {
+	return &liveSource{
+		pool:           pool,
+		interval:       interval,
+		deriveInterval: deriveInterval,
+		collector:      newCollector(),
+		intervalState:  intervalState,
+		lifetimeState:  lifetimeState,
+	}
+}
+
+func (ls *liveSource) Run(done <-chan struct{}, finished chan<- struct{}) {
+	defer close(finished)
+
+	pollInterval := lifetimePollFreq
+	if ls.deriveInterval {
+		ls.lifetimeState.EnableDeltaDerivation(ls.intervalState.Update)
+		pollInterval = ls.interval
+	} else {
+		go func() {
+			if err := ls.collector.StreamInterval(ls.pool, ls.interval, ls.intervalState.Update, done); err != nil {
+				log.Printf("interval collector stopped: %v", err)
+			}
+		}()
+	}
+
+	go func() {
+		if hists, err := ls.collector.FetchLifetime(ls.pool); err == nil && len(hists) > 0 {
+			ls.lifetimeState.Update(hists)
+		}
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if hists, err := ls.collector.FetchLifetime(ls.pool); err == nil && len(hists) > 0 {
+					ls.lifetimeState.Update(hists)
+				}
+			}
+		}
+	}()
+
+	<-done
+}
+
+// replaySource reads a -log file back through the same Display renderer
+// used for a live run, without ever invoking zpool. Each recorded interval
+// snapshot is replayed as-is into intervalState, and folded into a running
+// cumulative total pushed to lifetimeState, so both sections of the
+// display stay populated exactly as they would during a live session.
+type replaySource struct {
+	path          string
+	speed         float64
+	intervalState *State
+	lifetimeState *State
+}
+
+func newReplaySource(path string, speed float64, intervalState, lifetimeState *State) *replaySource {
+	return &replaySource{path: path, speed: speed, intervalState: intervalState, lifetimeState: lifetimeState}
+}
+
+func (rs *replaySource) Run(done <-chan struct{}, finished chan<- struct{}) {
+	defer close(finished)
+
+	records, err := readLogFile(rs.path)
+	if err != nil {
+		log.Fatalf("replay: %v", err)
+	}
+	if len(records) == 0 {
+		log.Fatalf("replay: %s contains no snapshots", rs.path)
+	}
+
+	cumulative := make(map[string]*DeviceHistogram)
+	prevTs := records[0].Timestamp
+	for _, rec := range records {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		if gap := rec.Timestamp.Sub(prevTs); gap > 0 && rs.speed > 0 {
+			time.Sleep(time.Duration(float64(gap) / rs.speed))
+		}
+		prevTs = rec.Timestamp
+
+		rs.intervalState.Update(rec.Devices)
+
+		for dev, hist := range rec.Devices {
+			cur, ok := cumulative[dev]
+			if !ok {
+				cur = &DeviceHistogram{Name: dev}
+				cumulative[dev] = cur
+			}
+			addHistogram(cur, hist)
+		}
+		snap := make(map[string]*DeviceHistogram, len(cumulative))
+		for dev, hist := range cumulative {
+			snap[dev] = hist
+		}
+		rs.lifetimeState.Update(snap)
+	}
+
+	fmt.Fprintln(os.Stderr, "replay: reached end of log file")
+	<-done
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// State holds parsed histogram data for either interval or lifetime.
+// deltaSink, when set via EnableDeltaDerivation, makes every Update also
+// push an element-wise delta against the previous snapshot - so
+// lifetimeState can drive intervalState directly instead of a second
+// `zpool iostat` stream (chunk5-4).
+type State struct {
+	mu          sync.RWMutex
+	histograms  map[string]*DeviceHistogram
+	lastUpdate  time.Time
+	updateCount uint64
+
+	prevSnapshot map[string]*DeviceHistogram
+	deltaSink    func(map[string]*DeviceHistogram)
+
+	keepHistory bool
+	history     map[string][]historySample // per device, oldest first, capped at historyDepth
+}
+
+func newState() *State {
+	return &State{
+		histograms: make(map[string]*DeviceHistogram),
+		lastUpdate: time.Now(),
+	}
+}
+
+// EnableDeltaDerivation makes every future Update compute cur-minus-prev
+// (see diffHistograms) and hand the result to sink, instead of s just
+// recording the raw cumulative snapshot. The first Update after this is
+// called has no previous snapshot to diff against, so it updates s but
+// does not call sink.
+func (s *State) EnableDeltaDerivation(sink func(map[string]*DeviceHistogram)) {
+	s.mu.Lock()
+	s.deltaSink = sink
+	s.mu.Unlock()
+}
+
+// EnableHistory makes every future Update also append each device's
+// snapshot to a bounded per-device ring buffer (see History), for
+// -heatmap mode (chunk5-5).
+func (s *State) EnableHistory() {
+	s.mu.Lock()
+	s.keepHistory = true
+	if s.history == nil {
+		s.history = make(map[string][]historySample)
+	}
+	s.mu.Unlock()
+}
+
+func (s *State) Update(histograms map[string]*DeviceHistogram) {
+	s.mu.Lock()
+	prev := s.prevSnapshot
+	sink := s.deltaSink
+	s.histograms = histograms
+	s.prevSnapshot = histograms
+	s.lastUpdate = time.Now()
+	s.updateCount++
+	if s.keepHistory {
+		now := time.Now()
+		for dev, hist := range histograms {
+			ring := append(s.history[dev], historySample{timestamp: now, hist: hist})
+			if len(ring) > historyDepth {
+				ring = ring[len(ring)-historyDepth:]
+			}
+			s.history[dev] = ring
+		}
+	}
+	s.mu.Unlock()
+
+	if sink != nil && prev != nil {
+		sink(diffHistograms(prev, histograms))
+	}
+}
+
+// History returns a copy of dev's recorded snapshots, oldest first. Empty
+// if EnableHistory was never called or dev has no history yet.
+func (s *State) History(dev string) []historySample {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	src := s.history[dev]
+	out := make([]historySample, len(src))
+	copy(out, src)
+	return out
+}
+
+func (s *State) Snapshot() (map[string]*DeviceHistogram, time.Time, uint64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snap := make(map[string]*DeviceHistogram)
+	for k, v := range s.histograms {
+		copyHist := &DeviceHistogram{Name: v.Name}
+		copyHist.Buckets = v.Buckets
+		snap[k] = copyHist
+	}
+	return snap, s.lastUpdate, s.updateCount
+}